@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+// Command metrics-exporter serves PTP/DPLL/GNSS device state as a
+// Prometheus scrape endpoint, fetching it on demand for each scrape
+// rather than polling in the background.
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/redhat-partner-solutions/vse-sync-testsuite/pkg/clients"
+	"github.com/redhat-partner-solutions/vse-sync-testsuite/pkg/collectors/devices"
+)
+
+const (
+	defaultListenAddress     = ":9090"
+	defaultMinScrapeInterval = 5 * time.Second
+	defaultScrapeTimeout     = 10 * time.Second
+
+	// prometheusScrapeTimeoutHeader is set by the Prometheus server on
+	// every scrape request to the number of seconds it will itself
+	// wait before giving up; honouring it keeps us from doing work the
+	// scraper has already abandoned.
+	prometheusScrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+)
+
+func main() {
+	listenAddress := flag.String("listen-address", defaultListenAddress, "address for the /metrics HTTP server")
+	namespace := flag.String("namespace", "", "namespace of the pod to exec device collection commands in")
+	podName := flag.String("pod", "", "pod to exec device collection commands in")
+	containerName := flag.String("container", "", "container within the pod to exec device collection commands in")
+	interfaceList := flag.String("interfaces", "", "comma-separated network interfaces to report metrics for")
+	minScrapeInterval := flag.Duration(
+		"min-scrape-interval", defaultMinScrapeInterval,
+		"minimum interval between underlying command executions per interface, to absorb a scrape storm",
+	)
+	flag.Parse()
+
+	interfaces := splitInterfaces(*interfaceList)
+	if len(interfaces) == 0 {
+		log.Fatal("metrics-exporter: -interfaces is required")
+	}
+
+	containerCtx, err := clients.NewContainerContext(*namespace, *podName, *containerName)
+	if err != nil {
+		log.Fatalf("metrics-exporter: failed to build container context: %s", err.Error())
+	}
+
+	collector := devices.NewDeviceMetricsCollector(containerCtx, interfaces, *minScrapeInterval)
+	http.Handle("/metrics", scrapeHandler(collector))
+
+	log.Infof("metrics-exporter: serving /metrics on %s for interfaces %v", *listenAddress, interfaces)
+	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+}
+
+func splitInterfaces(interfaceList string) []string {
+	var interfaces []string
+	for _, interfaceName := range strings.Split(interfaceList, ",") {
+		interfaceName = strings.TrimSpace(interfaceName)
+		if interfaceName != "" {
+			interfaces = append(interfaces, interfaceName)
+		}
+	}
+	return interfaces
+}
+
+// scrapeHandler builds the /metrics handler for collector. Each
+// request gets its own deadline (read from the scrape timeout
+// Prometheus sends, falling back to defaultScrapeTimeout for e.g. a
+// manual curl) derived from that request's own context, and its own
+// throwaway registry wrapping collector in a devices.RequestCollector
+// bound to that deadline. This keeps the timeout a per-request value
+// rather than mutable state shared across concurrent scrapes, and
+// means a client disconnecting cancels its own in-flight collection
+// rather than a fixed duration being the only thing that bounds it.
+func scrapeHandler(collector *devices.DeviceMetricsCollector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := defaultScrapeTimeout
+		if header := r.Header.Get(prometheusScrapeTimeoutHeader); header != "" {
+			if seconds, err := strconv.ParseFloat(header, 64); err == nil && seconds > 0 {
+				timeout = time.Duration(seconds * float64(time.Second))
+			}
+		}
+		goCtx, cancel := devices.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(devices.NewRequestCollector(collector, goCtx))
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
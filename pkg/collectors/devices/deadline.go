@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package devices
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// deadline is a reusable, re-armable cancellation signal modeled on
+// net.Conn's SetDeadline contract: arming it with a future time starts
+// a timer that closes a channel once it fires; arming it with the zero
+// Time clears any pending timer without firing it; re-arming while a
+// timer is already pending replaces the channel, so goroutines that
+// were waiting on the old one aren't woken by a deadline that no
+// longer applies.
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+	t      time.Time
+}
+
+func newDeadline() *deadline {
+	return &deadline{cancel: make(chan struct{})}
+}
+
+// set arms, re-arms or (for a zero Time) clears the deadline.
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil {
+		if d.timer.Stop() {
+			// the timer was still pending: replace its channel so
+			// goroutines waiting on it aren't woken by a superseded deadline.
+			d.cancel = make(chan struct{})
+		} else {
+			<-d.cancel // the timer already fired; drain its close.
+		}
+	}
+	d.timer = nil
+
+	select {
+	case <-d.cancel:
+		d.cancel = make(chan struct{})
+	default:
+	}
+
+	d.t = t
+	if t.IsZero() {
+		return
+	}
+
+	cancel := d.cancel
+	if until := time.Until(t); until <= 0 {
+		close(cancel)
+	} else {
+		d.timer = time.AfterFunc(until, func() { close(cancel) })
+	}
+}
+
+// wait returns the channel that closes once the deadline passes.
+// Callers must re-fetch it after every call to set, since set may
+// replace it.
+func (d *deadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+// time returns the Time most recently passed to set, and whether one
+// is armed (a zero Time, including the initial state, reports false).
+func (d *deadline) time() (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.t, !d.t.IsZero()
+}
+
+// deadlineContext layers deadline's re-armable cancellation onto a
+// parent context.Context, so a single clients.Cmd execution can be
+// bounded without every caller threading a raw cancel channel through
+// the fetcher API. Done must also honour the parent's own
+// cancellation: a deadlineContext is typically handed a per-request
+// context as parent (e.g. an HTTP request's context), and a caller
+// that shuts that down needs this context to wake up too, not just
+// when its own timer fires.
+type deadlineContext struct {
+	context.Context
+	d        *deadline
+	canceled chan struct{}
+
+	doneOnce sync.Once
+	done     chan struct{}
+}
+
+// Done fans dctx.d.wait(), the parent's Done channel and an explicit
+// cancellation signal into a single channel, computed once and cached
+// so repeated calls return the same value as context.Context requires.
+func (dctx *deadlineContext) Done() <-chan struct{} {
+	dctx.doneOnce.Do(func() {
+		dctx.done = make(chan struct{})
+		go func() {
+			select {
+			case <-dctx.d.wait():
+			case <-dctx.Context.Done():
+			case <-dctx.canceled:
+			}
+			close(dctx.done)
+		}()
+	})
+	return dctx.done
+}
+
+// Deadline reports the earlier of dctx's own armed deadline and the
+// parent's, so callers that need a concrete time (e.g. to arm
+// SO_RCVTIMEO on a raw socket) see the bound that will actually wake
+// Done first rather than just whatever the parent happens to carry.
+func (dctx *deadlineContext) Deadline() (time.Time, bool) {
+	localDeadline, localOK := dctx.d.time()
+	parentDeadline, parentOK := dctx.Context.Deadline()
+	switch {
+	case localOK && parentOK:
+		if localDeadline.Before(parentDeadline) {
+			return localDeadline, true
+		}
+		return parentDeadline, true
+	case localOK:
+		return localDeadline, true
+	case parentOK:
+		return parentDeadline, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func (dctx *deadlineContext) Err() error {
+	select {
+	case <-dctx.d.wait():
+		return context.DeadlineExceeded
+	case <-dctx.canceled:
+		return context.Canceled
+	default:
+		return dctx.Context.Err()
+	}
+}
+
+// WithDeadline returns a copy of parent bounded by t, and a cancel func
+// that clears the deadline early. The returned context's Done channel
+// is backed by a deadline private to that context; once the call
+// returns, cancel is the only way to change it. Done and Err still reflect parent's own cancellation, so a context
+// built this way composes correctly with a parent such as an HTTP
+// request's context.
+func WithDeadline(parent context.Context, t time.Time) (context.Context, context.CancelFunc) {
+	d := newDeadline()
+	d.set(t)
+	dctx := &deadlineContext{Context: parent, d: d, canceled: make(chan struct{})}
+	var cancelOnce sync.Once
+	cancel := func() {
+		d.set(time.Time{})
+		cancelOnce.Do(func() { close(dctx.canceled) })
+	}
+	return dctx, cancel
+}
+
+// WithTimeout is shorthand for WithDeadline(parent, time.Now().Add(timeout)).
+func WithTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return WithDeadline(parent, time.Now().Add(timeout))
+}
@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package devices
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const testWait = 100 * time.Millisecond
+
+func TestDeadlineFiresAfterSet(t *testing.T) {
+	d := newDeadline()
+	d.set(time.Now().Add(10 * time.Millisecond))
+
+	select {
+	case <-d.wait():
+	case <-time.After(testWait):
+		t.Fatal("deadline did not fire within the wait window")
+	}
+}
+
+func TestDeadlineClearDoesNotFire(t *testing.T) {
+	d := newDeadline()
+	d.set(time.Now().Add(10 * time.Millisecond))
+	d.set(time.Time{}) // clear before it fires
+
+	select {
+	case <-d.wait():
+		t.Fatal("deadline fired after being cleared")
+	case <-time.After(testWait):
+	}
+}
+
+func TestDeadlineRearmReplacesChannel(t *testing.T) {
+	d := newDeadline()
+	d.set(time.Now().Add(time.Hour))
+	first := d.wait()
+
+	d.set(time.Now().Add(10 * time.Millisecond))
+	second := d.wait()
+
+	if first == second {
+		t.Fatal("wait() returned the same channel after re-arming with a new deadline")
+	}
+
+	select {
+	case <-first:
+		t.Fatal("the superseded channel fired; it should never close once replaced")
+	case <-second:
+	case <-time.After(testWait):
+		t.Fatal("the current channel did not fire within the wait window")
+	}
+}
+
+func TestDeadlineInThePastFiresImmediately(t *testing.T) {
+	d := newDeadline()
+	d.set(time.Now().Add(-time.Second))
+
+	select {
+	case <-d.wait():
+	default:
+		t.Fatal("a deadline already in the past did not fire immediately")
+	}
+}
+
+func TestWithDeadlineFiresOnOwnTimeout(t *testing.T) {
+	goCtx, cancel := WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	select {
+	case <-goCtx.Done():
+		if goCtx.Err() != context.DeadlineExceeded {
+			t.Errorf("Err() = %v, want DeadlineExceeded", goCtx.Err())
+		}
+	case <-time.After(testWait):
+		t.Fatal("Done() did not close within the wait window")
+	}
+}
+
+func TestWithDeadlineWakesOnParentCancellation(t *testing.T) {
+	parent, parentCancel := context.WithCancel(context.Background())
+	goCtx, cancel := WithTimeout(parent, time.Hour)
+	defer cancel()
+
+	parentCancel()
+
+	select {
+	case <-goCtx.Done():
+		if goCtx.Err() != context.Canceled {
+			t.Errorf("Err() = %v, want Canceled", goCtx.Err())
+		}
+	case <-time.After(testWait):
+		t.Fatal("Done() did not close when the parent context was canceled")
+	}
+}
+
+func TestWithDeadlineDoneReturnsSameChannelEveryCall(t *testing.T) {
+	goCtx, cancel := WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	if goCtx.Done() != goCtx.Done() {
+		t.Error("Done() returned different channels across calls")
+	}
+}
+
+func TestWithDeadlineCancelFuncClosesDone(t *testing.T) {
+	goCtx, cancel := WithTimeout(context.Background(), time.Hour)
+	cancel()
+
+	select {
+	case <-goCtx.Done():
+		if goCtx.Err() != context.Canceled {
+			t.Errorf("Err() = %v, want Canceled", goCtx.Err())
+		}
+	case <-time.After(testWait):
+		t.Fatal("Done() did not close after calling the returned cancel func")
+	}
+}
+
+func TestWithDeadlineUnaffectedParentStaysOpen(t *testing.T) {
+	goCtx, cancel := WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	select {
+	case <-goCtx.Done():
+		t.Fatal("Done() closed despite no deadline firing and no cancellation")
+	default:
+	}
+	if goCtx.Err() != nil {
+		t.Errorf("Err() = %v, want nil", goCtx.Err())
+	}
+}
+
+func TestWithDeadlineReportsItsOwnDeadline(t *testing.T) {
+	goCtx, cancel := WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	_, ok := goCtx.Deadline()
+	if !ok {
+		t.Fatal("Deadline() reported no deadline despite WithTimeout")
+	}
+}
+
+func TestWithDeadlineReportsEarlierOfOwnAndParentDeadline(t *testing.T) {
+	parent, parentCancel := context.WithTimeout(context.Background(), time.Hour)
+	defer parentCancel()
+	goCtx, cancel := WithTimeout(parent, 10*time.Millisecond)
+	defer cancel()
+
+	ownDeadline, _ := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	want, _ := ownDeadline.Deadline()
+	got, ok := goCtx.Deadline()
+	if !ok {
+		t.Fatal("Deadline() reported no deadline despite WithTimeout")
+	}
+	if got.After(want.Add(testWait)) {
+		t.Errorf("Deadline() = %v, want close to the shorter (own) timeout %v", got, want)
+	}
+}
+
+func TestWithDeadlineNoDeadlineWhenNeitherArmed(t *testing.T) {
+	goCtx := &deadlineContext{Context: context.Background(), d: newDeadline(), canceled: make(chan struct{})}
+
+	if _, ok := goCtx.Deadline(); ok {
+		t.Error("Deadline() reported a deadline despite none being armed")
+	}
+}
@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package devices
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// This file is the streaming counterpart to dpll_netlink.go's
+// synchronous request/dump path: it resolves and joins the "dpll"
+// family's "monitor" multicast group so DPLL state transitions (lock
+// acquired/lost, pin reconfigured, ...) can be observed as the kernel
+// emits them, instead of only ever being visible on the next poll.
+
+const (
+	ctrlAttrMcastGroups  = 7
+	ctrlAttrMcastGrpName = 1
+	ctrlAttrMcastGrpID   = 2
+
+	dpllMonitorGroupName = "monitor"
+)
+
+// DPLLEvent is one notification observed on the dpll family's monitor
+// multicast group. Exactly one of Device or Pin is set, mirroring
+// which kind of object the kernel reported a change for.
+type DPLLEvent struct {
+	Device *DPLLInfo
+	Pin    *DPLLPinInfo
+}
+
+// resolveMulticastGroup issues a CTRL_CMD_GETFAMILY request for
+// familyName and returns the numeric id the kernel assigned groupName
+// within that family's CTRL_ATTR_MCAST_GROUPS list, bounded by goCtx.
+func (conn *dpllNetlinkConn) resolveMulticastGroup(goCtx context.Context, familyName, groupName string) (uint32, error) {
+	req := buildGenlMessage(unix.GENL_ID_CTRL, genlCtrlCmdGetFamily,
+		[]nlAttr{{Type: ctrlAttrFamilyName, Value: nullTerminate(familyName)}})
+	reply, err := conn.requestReply(goCtx, req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve %q multicast groups: %w", familyName, err)
+	}
+	attrs, err := parseAttrs(reply[genlHeaderLen:])
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %q family reply: %w", familyName, err)
+	}
+	raw, ok := attrs[ctrlAttrMcastGroups]
+	if !ok {
+		return 0, fmt.Errorf("%q family advertises no multicast groups", familyName)
+	}
+	return findMulticastGroupID(raw, groupName)
+}
+
+// findMulticastGroupID walks a CTRL_ATTR_MCAST_GROUPS value -- a
+// nested list of per-group attribute sets, indexed by position rather
+// than a fixed tag -- looking for one named groupName.
+func findMulticastGroupID(mcastGroups []byte, groupName string) (uint32, error) {
+	groups, err := parseAttrs(mcastGroups)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse multicast group list: %w", err)
+	}
+	for _, groupRaw := range groups {
+		groupAttrs, err := parseAttrs(groupRaw)
+		if err != nil {
+			continue
+		}
+		nameRaw, ok := groupAttrs[ctrlAttrMcastGrpName]
+		if !ok || strings.TrimRight(string(nameRaw), "\x00") != groupName {
+			continue
+		}
+		idRaw, ok := groupAttrs[ctrlAttrMcastGrpID]
+		if !ok || len(idRaw) < 4 {
+			return 0, fmt.Errorf("multicast group %q has no id attribute", groupName)
+		}
+		return binary.LittleEndian.Uint32(idRaw), nil
+	}
+	return 0, fmt.Errorf("no multicast group named %q", groupName)
+}
+
+// joinMonitorGroup resolves the dpll family's "monitor" multicast
+// group and subscribes conn's socket to it via NETLINK_ADD_MEMBERSHIP,
+// so a subsequent read on conn.fd observes kernel-pushed DPLL state
+// change notifications rather than requiring a fresh dump.
+func (conn *dpllNetlinkConn) joinMonitorGroup(goCtx context.Context) error {
+	groupID, err := conn.resolveMulticastGroup(goCtx, dpllFamilyName, dpllMonitorGroupName)
+	if err != nil {
+		return err
+	}
+	if err := unix.SetsockoptInt(conn.fd, unix.SOL_NETLINK, unix.NETLINK_ADD_MEMBERSHIP, int(groupID)); err != nil {
+		return fmt.Errorf("failed to join dpll %q multicast group: %w", dpllMonitorGroupName, err)
+	}
+	return nil
+}
+
+// decodeDPLLEvent turns one monitor notification's attribute set into
+// a DPLLEvent, distinguishing a pin notification from a device one by
+// the presence of DPLL_A_PIN_ID -- the kernel reuses the same
+// DPLL_CMD_DEVICE_GET/PIN_GET attribute tags for notifications as for
+// dump replies, it just pushes them unsolicited. Returns false if
+// attrs matches neither shape.
+func decodeDPLLEvent(attrs map[uint16][]byte) (DPLLEvent, bool) {
+	if _, ok := attrs[dpllAPinID]; ok {
+		pin := decodeDPLLPinInfo(attrs)
+		return DPLLEvent{Pin: &pin}, true
+	}
+	if _, ok := attrs[dpllAID]; ok {
+		dpll := decodeDPLLInfo(attrs)
+		return DPLLEvent{Device: &dpll}, true
+	}
+	return DPLLEvent{}, false
+}
+
+// MonitorDPLLEvents subscribes to the dpll family's "monitor"
+// multicast group and streams device/pin state-change notifications
+// on the returned channel until goCtx is done, at which point the
+// channel is closed and the underlying socket is released. This lets
+// a caller react to a DPLL losing lock (or any other state
+// transition) as it happens, instead of waiting for the next
+// GetDevDPLLInfo poll to notice.
+//
+// goCtx need not carry a Deadline: a plain context.WithCancel is the
+// idiomatic way to shut down a long-lived stream like this, and
+// armSocketDeadline is a no-op without one, which would otherwise
+// leave the in-flight unix.Read blocking until a notification happens
+// to arrive -- possibly never, e.g. once a DPLL is already locked and
+// stable. A separate goroutine closes the socket as soon as goCtx is
+// done so the blocked read is interrupted directly, independent of
+// whether goCtx has a deadline.
+func MonitorDPLLEvents(goCtx context.Context) (<-chan DPLLEvent, error) {
+	conn, err := newDPLLNetlinkConn(goCtx)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.joinMonitorGroup(goCtx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	var closeOnce sync.Once
+	closeConn := func() {
+		closeOnce.Do(func() {
+			if closeErr := conn.Close(); closeErr != nil {
+				log.Errorf("failed to close dpll monitor socket: %s", closeErr.Error())
+			}
+		})
+	}
+	go func() {
+		<-goCtx.Done()
+		closeConn()
+	}()
+
+	events := make(chan DPLLEvent)
+	go func() {
+		defer closeConn()
+		runDPLLMonitorLoop(goCtx, conn.fd, events)
+	}()
+	return events, nil
+}
+
+// runDPLLMonitorLoop reads netlink messages from fd, decoding and
+// emitting each one as a DPLLEvent on events, until a read fails (in
+// particular, fd being closed out from under it by MonitorDPLLEvents'
+// cancellation goroutine) -- at which point it closes events and
+// returns. Factored out of MonitorDPLLEvents so the read-and-decode
+// loop can be exercised against a plain socket pair in tests, without
+// needing a real dpll netlink family to subscribe to.
+func runDPLLMonitorLoop(goCtx context.Context, fd int, events chan<- DPLLEvent) {
+	defer close(events)
+	for {
+		buf, err := readNetlinkMsg(goCtx, fd)
+		if err != nil {
+			if goCtx.Err() == nil {
+				log.Errorf("failed to read dpll monitor notification: %s", err.Error())
+			}
+			return
+		}
+		msgs, _, err := splitNlMsgs(buf)
+		if err != nil {
+			log.Errorf("failed to parse dpll monitor notification: %s", err.Error())
+			continue
+		}
+		for _, m := range msgs {
+			if len(m) < genlHeaderLen {
+				continue
+			}
+			attrs, err := parseAttrs(m[genlHeaderLen:])
+			if err != nil {
+				log.Errorf("failed to parse dpll monitor attributes: %s", err.Error())
+				continue
+			}
+			event, ok := decodeDPLLEvent(attrs)
+			if !ok {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-goCtx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package devices
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestFindMulticastGroupID(t *testing.T) {
+	groups := encodeAttrs([]nlAttr{
+		{Type: 1, Value: encodeAttrs([]nlAttr{
+			{Type: ctrlAttrMcastGrpName, Value: nullTerminate("config")},
+			{Type: ctrlAttrMcastGrpID, Value: u32Bytes(5)},
+		})},
+		{Type: 2, Value: encodeAttrs([]nlAttr{
+			{Type: ctrlAttrMcastGrpName, Value: nullTerminate(dpllMonitorGroupName)},
+			{Type: ctrlAttrMcastGrpID, Value: u32Bytes(9)},
+		})},
+	})
+
+	id, err := findMulticastGroupID(groups, dpllMonitorGroupName)
+	if err != nil {
+		t.Fatalf("findMulticastGroupID() unexpected error: %v", err)
+	}
+	if id != 9 {
+		t.Errorf("findMulticastGroupID() = %d, want 9", id)
+	}
+}
+
+func TestFindMulticastGroupIDNotFound(t *testing.T) {
+	groups := encodeAttrs([]nlAttr{
+		{Type: 1, Value: encodeAttrs([]nlAttr{
+			{Type: ctrlAttrMcastGrpName, Value: nullTerminate("config")},
+			{Type: ctrlAttrMcastGrpID, Value: u32Bytes(5)},
+		})},
+	})
+
+	if _, err := findMulticastGroupID(groups, dpllMonitorGroupName); err == nil {
+		t.Fatal("findMulticastGroupID() = nil error, want error for missing group")
+	}
+}
+
+func TestDecodeDPLLEvent(t *testing.T) {
+	deviceEvent, ok := decodeDPLLEvent(map[uint16][]byte{
+		dpllAID:         u32Bytes(1),
+		dpllALockStatus: {4}, // holdover
+	})
+	if !ok || deviceEvent.Device == nil || deviceEvent.Pin != nil {
+		t.Fatalf("decodeDPLLEvent() device case = %+v, %v", deviceEvent, ok)
+	}
+	if deviceEvent.Device.LockStatus != "holdover" {
+		t.Errorf("Device.LockStatus = %q, want holdover", deviceEvent.Device.LockStatus)
+	}
+
+	pinEvent, ok := decodeDPLLEvent(map[uint16][]byte{
+		dpllAPinID:       u32Bytes(10),
+		dpllAPinParentID: u32Bytes(1),
+		dpllAPinState:    {2}, // disconnected
+	})
+	if !ok || pinEvent.Pin == nil || pinEvent.Device != nil {
+		t.Fatalf("decodeDPLLEvent() pin case = %+v, %v", pinEvent, ok)
+	}
+	if pinEvent.Pin.State != "disconnected" {
+		t.Errorf("Pin.State = %q, want disconnected", pinEvent.Pin.State)
+	}
+
+	if _, ok := decodeDPLLEvent(map[uint16][]byte{dpllATemp: u32Bytes(1000)}); ok {
+		t.Error("decodeDPLLEvent() = true for attrs matching neither device nor pin shape")
+	}
+}
+
+// TestRunDPLLMonitorLoopReturnsOnCancel exercises MonitorDPLLEvents'
+// shutdown path without needing a real dpll netlink family: a plain
+// AF_UNIX socketpair stands in for the netlink socket, and a
+// context.WithCancel (no Deadline, so armSocketDeadline can't help)
+// stands in for the idiomatic way a caller would stop a long-lived
+// stream. It asserts that once the context is canceled and the read end
+// of the socket is closed -- what MonitorDPLLEvents' cancellation
+// goroutine does to conn.fd -- the loop returns and closes events.
+func TestRunDPLLMonitorLoopReturnsOnCancel(t *testing.T) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Fatalf("unix.Socketpair() unexpected error: %v", err)
+	}
+	defer unix.Close(fds[1])
+
+	goCtx, cancel := context.WithCancel(context.Background())
+	events := make(chan DPLLEvent)
+	loopDone := make(chan struct{})
+	go func() {
+		runDPLLMonitorLoop(goCtx, fds[0], events)
+		close(loopDone)
+	}()
+
+	cancel()
+	unix.Close(fds[0]) // what MonitorDPLLEvents' own cancellation goroutine does
+
+	select {
+	case <-loopDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("runDPLLMonitorLoop did not return after its socket was closed on cancellation")
+	}
+	if _, ok := <-events; ok {
+		t.Error("events channel was not closed after runDPLLMonitorLoop returned")
+	}
+}
@@ -0,0 +1,462 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package devices
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"golang.org/x/sys/unix"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The attribute/command numbers below mirror the kernel's DPLL generic
+// netlink ABI (include/uapi/linux/dpll.h, kernel >= 6.1). They are not
+// exposed by x/sys/unix so we define the subset we consume here.
+const (
+	genlCtrlCmdGetFamily = 3
+
+	ctrlAttrFamilyID   = 1
+	ctrlAttrFamilyName = 2
+
+	dpllFamilyName = "dpll"
+
+	dpllCmdDeviceGet = 2
+	dpllCmdPinGet    = 8
+
+	dpllAID         = 1
+	dpllAClockID    = 4
+	dpllAMode       = 5
+	dpllALockStatus = 7
+	dpllATemp       = 8
+	dpllAType       = 9
+
+	dpllAPinID          = 18
+	dpllAPinParentID    = 20
+	dpllAPinState       = 22
+	dpllAPinPhaseOffset = 24
+
+	// rtmGetLink, iflaIfname and iflaDPLLPin are the subset of the
+	// rtnetlink link ABI (include/uapi/linux/rtnetlink.h,
+	// include/uapi/linux/if_link.h) needed to resolve which DPLL pin a
+	// network interface's recovered clock is wired to. IFLA_DPLL_PIN is
+	// recent enough (kernel >= 6.7) that it isn't in x/sys/unix yet.
+	rtmGetLink  = unix.RTM_GETLINK
+	iflaIfname  = unix.IFLA_IFNAME
+	iflaDPLLPin = 0x49
+
+	ifinfomsgLen = 16 // struct ifinfomsg
+)
+
+// dpllPinPhaseOffsetDivisor converts a raw DPLL_A_PIN_PHASE_OFFSET
+// value into seconds. Per include/uapi/linux/dpll.h the kernel reports
+// this attribute in thousandths of a nanosecond, i.e. 10^-12 s units,
+// so dividing by 1e12 yields seconds. This is unrelated to -- and
+// roughly ten orders of magnitude different from -- unitConversionFactor,
+// which scales the sysfs fallback's own (coarser) offset encoding.
+const dpllPinPhaseOffsetDivisor = 1e12
+
+// DPLLInfo is the state of a single DPLL instance as reported by the
+// kernel DPLL netlink subsystem.
+type DPLLInfo struct {
+	ID         uint32 `json:"id"`
+	Type       string `json:"type"`
+	LockStatus string `json:"lockStatus"`
+	Mode       string `json:"mode"`
+	// TempMilliC is the reported device temperature in milli-degrees
+	// Celsius, or nil when the device does not expose it.
+	TempMilliC *int32 `json:"tempMilliC,omitempty"`
+}
+
+// DPLLPinInfo is the state of a single pin feeding or fed by a DPLL.
+type DPLLPinInfo struct {
+	ID          uint32  `json:"id"`
+	ParentID    uint32  `json:"parentId"`
+	State       string  `json:"state"`
+	PhaseOffset float64 `json:"phaseOffset"`
+}
+
+// dpllLockStatusNames and dpllTypeNames translate the small integer
+// enums the kernel reports into the strings the rest of this package
+// (and downstream analysers) already expect from the sysfs fetcher.
+var dpllLockStatusNames = map[uint32]string{
+	1: "unlocked",
+	2: "locked",
+	3: "locked-ho-acq",
+	4: "holdover",
+}
+
+var dpllTypeNames = map[uint32]string{
+	1: "pps",
+	2: "eec",
+}
+
+var dpllPinStateNames = map[uint32]string{
+	1: "connected",
+	2: "disconnected",
+	3: "selectable",
+}
+
+// dpllModeNames translates DPLL_A_MODE the same way its sibling enums
+// above are translated, so Mode isn't the only DPLLInfo field left as
+// a bare numeric string for downstream consumers to special-case.
+var dpllModeNames = map[uint32]string{
+	1: "manual",
+	2: "automatic",
+}
+
+// dpllLockStatusCodes is the reverse of dpllLockStatusNames, so the
+// Prometheus collector can export a DPLLInfo.LockStatus string as the
+// numeric code the kernel reported it with.
+var dpllLockStatusCodes = func() map[string]uint32 {
+	codes := make(map[string]uint32, len(dpllLockStatusNames))
+	for code, name := range dpllLockStatusNames {
+		codes[name] = code
+	}
+	return codes
+}()
+
+// dpllLockStatusCode returns the numeric DPLL_A_LOCK_STATUS code for
+// name, or 0 (matching the kernel's own "unset" value) if unknown.
+func dpllLockStatusCode(name string) float64 {
+	return float64(dpllLockStatusCodes[name])
+}
+
+// dpllClockIDMapMu guards dpllClockIDMap.
+var dpllClockIDMapMu sync.RWMutex
+
+// dpllClockIDMap correlates a DPLL_A_CLOCK_ID value back to the network
+// interface it was discovered through. Only fetchDPLLInfoNetlink
+// writes it. The monitor multicast stream (see dpll_monitor.go) neither
+// writes nor reads it, and the DPLLInfo it emits carries no clock id.
+var dpllClockIDMap = make(map[uint64]string)
+
+// RegisterDPLLClockID records which interface a DPLL clock-id belongs
+// to. fetchDPLLInfoNetlink calls this once it has resolved the
+// clock-id for interfaceName.
+func RegisterDPLLClockID(clockID uint64, interfaceName string) {
+	dpllClockIDMapMu.Lock()
+	defer dpllClockIDMapMu.Unlock()
+	dpllClockIDMap[clockID] = interfaceName
+}
+
+// InterfaceForDPLLClockID returns the interface registered against
+// clockID, if any.
+func InterfaceForDPLLClockID(clockID uint64) (string, bool) {
+	dpllClockIDMapMu.RLock()
+	defer dpllClockIDMapMu.RUnlock()
+	name, ok := dpllClockIDMap[clockID]
+	return name, ok
+}
+
+// dpllNetlinkConn wraps the raw NETLINK_GENERIC socket plumbing needed
+// to talk to the kernel DPLL family: family resolution, request/dump,
+// and nlattr parsing. It intentionally knows nothing about interfaces
+// or PTPDeviceInfo, so it's shared by both the synchronous
+// request/dump path below and the multicast monitor stream in
+// dpll_monitor.go.
+type dpllNetlinkConn struct {
+	fd       int
+	familyID uint16
+}
+
+// newDPLLNetlinkConn opens a NETLINK_GENERIC socket and resolves the
+// "dpll" family id. It returns an error (rather than panicking) when the
+// DPLL family is absent, e.g. on kernels older than 6.1 or when the
+// dpll_core module isn't loaded, so callers can fall back to sysfs.
+func newDPLLNetlinkConn(goCtx context.Context) (*dpllNetlinkConn, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_GENERIC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open netlink generic socket: %w", err)
+	}
+	addr := &unix.SockaddrNetlink{Family: unix.AF_NETLINK}
+	if err := unix.Bind(fd, addr); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to bind netlink generic socket: %w", err)
+	}
+
+	conn := &dpllNetlinkConn{fd: fd}
+	familyID, err := conn.resolveFamily(goCtx, dpllFamilyName)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	conn.familyID = familyID
+	return conn, nil
+}
+
+func (conn *dpllNetlinkConn) Close() error {
+	return unix.Close(conn.fd)
+}
+
+// resolveFamily issues a CTRL_CMD_GETFAMILY request for familyName and
+// returns the numeric family id the kernel assigned it at registration,
+// bounded by goCtx.
+func (conn *dpllNetlinkConn) resolveFamily(goCtx context.Context, familyName string) (uint16, error) {
+	req := buildGenlMessage(unix.GENL_ID_CTRL, genlCtrlCmdGetFamily,
+		[]nlAttr{{Type: ctrlAttrFamilyName, Value: nullTerminate(familyName)}})
+	reply, err := conn.requestReply(goCtx, req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve %q netlink family: %w", familyName, err)
+	}
+	attrs, err := parseAttrs(reply[genlHeaderLen:])
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %q family reply: %w", familyName, err)
+	}
+	raw, ok := attrs[ctrlAttrFamilyID]
+	if !ok {
+		return 0, fmt.Errorf("%q netlink family is not registered", familyName)
+	}
+	return binary.LittleEndian.Uint16(raw), nil
+}
+
+// dumpDevices issues DPLL_CMD_DEVICE_GET with NLM_F_DUMP and returns one
+// attribute set per DPLL device the kernel knows about, bounded by goCtx.
+func (conn *dpllNetlinkConn) dumpDevices(goCtx context.Context) ([]map[uint16][]byte, error) {
+	req := buildGenlMessage(conn.familyID, dpllCmdDeviceGet, nil)
+	return conn.dump(goCtx, req)
+}
+
+// dumpPins issues DPLL_CMD_PIN_GET with NLM_F_DUMP and returns one
+// attribute set per pin the kernel knows about, bounded by goCtx.
+func (conn *dpllNetlinkConn) dumpPins(goCtx context.Context) ([]map[uint16][]byte, error) {
+	req := buildGenlMessage(conn.familyID, dpllCmdPinGet, nil)
+	return conn.dump(goCtx, req)
+}
+
+// resolveDPLLPinID issues an RTM_GETLINK request for interfaceName over
+// NETLINK_ROUTE and returns the IFLA_DPLL_PIN attribute identifying
+// which DPLL pin its recovered clock is wired to. This is the only
+// link between a network interface and "its" DPLL: the DPLL netlink
+// family itself has no concept of interfaces, only devices and pins.
+func resolveDPLLPinID(goCtx context.Context, interfaceName string) (uint32, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_ROUTE)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open netlink route socket: %w", err)
+	}
+	defer unix.Close(fd)
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return 0, fmt.Errorf("failed to bind netlink route socket: %w", err)
+	}
+
+	req := buildLinkGetMessage(interfaceName)
+	if err := armSocketDeadline(goCtx, fd); err != nil {
+		return 0, err
+	}
+	if _, err := unix.Write(fd, req); err != nil {
+		return 0, wrapNetlinkTimeout(goCtx, fmt.Sprintf("failed to write RTM_GETLINK request for %s", interfaceName), err)
+	}
+	// The link dump for an SR-IOV capable NIC (IFLA_VFINFO_LIST,
+	// IFLA_STATS64, IFLA_AF_SPEC, queue counts, ...) routinely runs past
+	// defaultGenlSize, so size the buffer exactly rather than assuming
+	// one fixed constant fits both this and the much smaller DPLL dumps.
+	buf, err := readNetlinkMsg(goCtx, fd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read RTM_GETLINK reply for %s: %w", interfaceName, err)
+	}
+	payload, err := parseSingleNlMsg(buf)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse RTM_GETLINK reply for %s: %w", interfaceName, err)
+	}
+	if len(payload) < ifinfomsgLen {
+		return 0, fmt.Errorf("short RTM_GETLINK reply for %s", interfaceName)
+	}
+	attrs, err := parseAttrs(payload[ifinfomsgLen:])
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse RTM_GETLINK attributes for %s: %w", interfaceName, err)
+	}
+	raw, ok := attrs[iflaDPLLPin]
+	if !ok || len(raw) < 4 {
+		return 0, fmt.Errorf("interface %s has no associated dpll pin", interfaceName)
+	}
+	return binary.LittleEndian.Uint32(raw), nil
+}
+
+// buildLinkGetMessage assembles an RTM_GETLINK request carrying only
+// IFLA_IFNAME, the minimum needed to ask the kernel for one interface's
+// link attributes by name.
+func buildLinkGetMessage(interfaceName string) []byte {
+	ifinfo := make([]byte, ifinfomsgLen)
+	ifinfo[0] = unix.AF_UNSPEC
+
+	nameBytes := nullTerminate(interfaceName)
+	header := make([]byte, nlaHeaderLen)
+	binary.LittleEndian.PutUint16(header[0:2], uint16(nlaHeaderLen+len(nameBytes)))
+	binary.LittleEndian.PutUint16(header[2:4], iflaIfname)
+	body := append(ifinfo, header...)
+	body = append(body, nameBytes...)
+	if pad := nlaAlign(len(nameBytes)) - len(nameBytes); pad > 0 {
+		body = append(body, make([]byte, pad)...)
+	}
+
+	msg := make([]byte, nlmsgHeaderLen)
+	binary.LittleEndian.PutUint32(msg[0:4], uint32(nlmsgHeaderLen+len(body)))
+	binary.LittleEndian.PutUint16(msg[4:6], rtmGetLink)
+	binary.LittleEndian.PutUint16(msg[6:8], unix.NLM_F_REQUEST)
+	return append(msg, body...)
+}
+
+// filterDPLLDumpForInterface narrows a system-wide DPLL device/pin dump
+// down to the single DPLL that owns pinID (and that DPLL's own pins),
+// so a multi-NIC host doesn't fold every DPLL on the box into the
+// result for one interface.
+func filterDPLLDumpForInterface(
+	deviceAttrs, pinAttrs []map[uint16][]byte, pinID uint32,
+) ([]map[uint16][]byte, []map[uint16][]byte, error) {
+	var dpllID uint32
+	found := false
+	for _, attrs := range pinAttrs {
+		raw, ok := attrs[dpllAPinID]
+		if !ok || binary.LittleEndian.Uint32(raw) != pinID {
+			continue
+		}
+		parentRaw, ok := attrs[dpllAPinParentID]
+		if !ok {
+			continue
+		}
+		dpllID = binary.LittleEndian.Uint32(parentRaw)
+		found = true
+		break
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("no dpll owns pin %d", pinID)
+	}
+
+	var devices []map[uint16][]byte
+	for _, attrs := range deviceAttrs {
+		if raw, ok := attrs[dpllAID]; ok && binary.LittleEndian.Uint32(raw) == dpllID {
+			devices = append(devices, attrs)
+		}
+	}
+	var pins []map[uint16][]byte
+	for _, attrs := range pinAttrs {
+		if raw, ok := attrs[dpllAPinParentID]; ok && binary.LittleEndian.Uint32(raw) == dpllID {
+			pins = append(pins, attrs)
+		}
+	}
+	return devices, pins, nil
+}
+
+// decodeDPLLInfo translates one DPLL device's attribute set -- from
+// either a DPLL_CMD_DEVICE_GET dump or a monitor multicast
+// notification, the two share the same attribute tags -- into a
+// DPLLInfo.
+func decodeDPLLInfo(attrs map[uint16][]byte) DPLLInfo {
+	dpll := DPLLInfo{}
+	if raw, ok := attrs[dpllAID]; ok {
+		dpll.ID = binary.LittleEndian.Uint32(raw)
+	}
+	if raw, ok := attrs[dpllAType]; ok && len(raw) >= 1 {
+		dpll.Type = dpllTypeNames[uint32(raw[0])]
+	}
+	if raw, ok := attrs[dpllALockStatus]; ok && len(raw) >= 1 {
+		dpll.LockStatus = dpllLockStatusNames[uint32(raw[0])]
+	}
+	if raw, ok := attrs[dpllAMode]; ok && len(raw) >= 1 {
+		dpll.Mode = dpllModeNames[uint32(raw[0])]
+	}
+	if raw, ok := attrs[dpllATemp]; ok && len(raw) >= 4 {
+		temp := int32(binary.LittleEndian.Uint32(raw))
+		dpll.TempMilliC = &temp
+	}
+	return dpll
+}
+
+// decodeDPLLPinInfo translates one pin's attribute set -- from either a
+// DPLL_CMD_PIN_GET dump or a monitor multicast notification -- into a
+// DPLLPinInfo.
+func decodeDPLLPinInfo(attrs map[uint16][]byte) DPLLPinInfo {
+	pin := DPLLPinInfo{}
+	if raw, ok := attrs[dpllAPinID]; ok {
+		pin.ID = binary.LittleEndian.Uint32(raw)
+	}
+	if raw, ok := attrs[dpllAPinParentID]; ok {
+		pin.ParentID = binary.LittleEndian.Uint32(raw)
+	}
+	if raw, ok := attrs[dpllAPinState]; ok && len(raw) >= 1 {
+		pin.State = dpllPinStateNames[uint32(raw[0])]
+	}
+	if raw, ok := attrs[dpllAPinPhaseOffset]; ok && len(raw) >= 8 {
+		pin.PhaseOffset = float64(int64(binary.LittleEndian.Uint64(raw))) / dpllPinPhaseOffsetDivisor
+	}
+	return pin
+}
+
+func buildDevDPLLInfo(deviceAttrs, pinAttrs []map[uint16][]byte, timestamp string) DevDPLLInfo {
+	info := DevDPLLInfo{Timestamp: timestamp}
+	for _, attrs := range deviceAttrs {
+		info.DPLLs = append(info.DPLLs, decodeDPLLInfo(attrs))
+	}
+	for _, attrs := range pinAttrs {
+		info.Pins = append(info.Pins, decodeDPLLPinInfo(attrs))
+	}
+	return info
+}
+
+// fetchDPLLInfoNetlink gathers device and pin state for interfaceName
+// via the kernel DPLL generic netlink family. It returns an error when
+// the family is unavailable so GetDevDPLLInfo can fall back to sysfs.
+// goCtx bounds every blocking netlink read/write this call makes (and
+// the rtnetlink exchange in resolveDPLLPinID), the same as it bounds
+// the sysfs fallback.
+//
+// The DPLL family itself has no notion of interfaces, so the dump is
+// scoped to interfaceName by first resolving its DPLL pin over
+// rtnetlink and filtering the device/pin dump down to the DPLL that
+// pin belongs to. Without this, a multi-NIC host (e.g. dual-E810) gets
+// every DPLL on the box folded into the result for every interface,
+// and RegisterDPLLClockID would clobber earlier interfaces' mappings.
+func fetchDPLLInfoNetlink(goCtx context.Context, interfaceName string, timestamp string) (DevDPLLInfo, error) {
+	pinID, err := resolveDPLLPinID(goCtx, interfaceName)
+	if err != nil {
+		return DevDPLLInfo{}, fmt.Errorf("failed to resolve dpll pin for %s: %w", interfaceName, err)
+	}
+
+	conn, err := newDPLLNetlinkConn(goCtx)
+	if err != nil {
+		return DevDPLLInfo{}, err
+	}
+	defer func() {
+		if closeErr := conn.Close(); closeErr != nil {
+			log.Errorf("failed to close dpll netlink socket: %s", closeErr.Error())
+		}
+	}()
+
+	deviceAttrs, err := conn.dumpDevices(goCtx)
+	if err != nil {
+		return DevDPLLInfo{}, fmt.Errorf("failed to dump dpll devices for %s: %w", interfaceName, err)
+	}
+	pinAttrs, err := conn.dumpPins(goCtx)
+	if err != nil {
+		return DevDPLLInfo{}, fmt.Errorf("failed to dump dpll pins for %s: %w", interfaceName, err)
+	}
+
+	deviceAttrs, pinAttrs, err = filterDPLLDumpForInterface(deviceAttrs, pinAttrs, pinID)
+	if err != nil {
+		return DevDPLLInfo{}, fmt.Errorf("failed to scope dpll dump to %s: %w", interfaceName, err)
+	}
+
+	info := buildDevDPLLInfo(deviceAttrs, pinAttrs, timestamp)
+	for _, attrs := range deviceAttrs {
+		if raw, ok := attrs[dpllAClockID]; ok && len(raw) >= 8 {
+			RegisterDPLLClockID(binary.LittleEndian.Uint64(raw), interfaceName)
+		}
+	}
+	return info, nil
+}
+
+// dpllNetlinkAvailable reports whether the kernel DPLL generic netlink
+// family can be resolved on this host. GetDevDPLLInfo uses it to pick
+// between the netlink and sysfs code paths at runtime. goCtx bounds
+// the family-resolution request this makes.
+func dpllNetlinkAvailable(goCtx context.Context) bool {
+	conn, err := newDPLLNetlinkConn(goCtx)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
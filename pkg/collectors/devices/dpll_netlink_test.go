@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package devices
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func u32Bytes(v uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, v)
+	return buf
+}
+
+func u64Bytes(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return buf
+}
+
+func TestBuildDevDPLLInfo(t *testing.T) {
+	deviceAttrs := []map[uint16][]byte{
+		{
+			dpllAID:         u32Bytes(1),
+			dpllAType:       {2}, // eec
+			dpllALockStatus: {2}, // locked
+			dpllATemp:       u32Bytes(42000),
+		},
+	}
+	pinAttrs := []map[uint16][]byte{
+		{
+			dpllAPinID:          u32Bytes(10),
+			dpllAPinParentID:    u32Bytes(1),
+			dpllAPinState:       {1}, // connected
+			dpllAPinPhaseOffset: u64Bytes(250),
+		},
+	}
+
+	info := buildDevDPLLInfo(deviceAttrs, pinAttrs, "2026-07-28T00:00:00Z")
+
+	if info.Timestamp != "2026-07-28T00:00:00Z" {
+		t.Errorf("Timestamp = %q, want the passed-in timestamp", info.Timestamp)
+	}
+	if len(info.DPLLs) != 1 {
+		t.Fatalf("len(DPLLs) = %d, want 1", len(info.DPLLs))
+	}
+	dpll := info.DPLLs[0]
+	if dpll.ID != 1 || dpll.Type != "eec" || dpll.LockStatus != "locked" {
+		t.Errorf("DPLLs[0] = %+v, want ID=1 Type=eec LockStatus=locked", dpll)
+	}
+	if dpll.TempMilliC == nil || *dpll.TempMilliC != 42000 {
+		t.Errorf("DPLLs[0].TempMilliC = %v, want 42000", dpll.TempMilliC)
+	}
+
+	if len(info.Pins) != 1 {
+		t.Fatalf("len(Pins) = %d, want 1", len(info.Pins))
+	}
+	pin := info.Pins[0]
+	if pin.ID != 10 || pin.ParentID != 1 || pin.State != "connected" {
+		t.Errorf("Pins[0] = %+v, want ID=10 ParentID=1 State=connected", pin)
+	}
+	if pin.PhaseOffset != 250.0/dpllPinPhaseOffsetDivisor {
+		t.Errorf("Pins[0].PhaseOffset = %v, want %v", pin.PhaseOffset, 250.0/dpllPinPhaseOffsetDivisor)
+	}
+}
+
+func TestBuildDevDPLLInfoMissingOptionalAttrs(t *testing.T) {
+	// A device missing its temperature attribute (not every DPLL
+	// exposes one) should come back with a nil TempMilliC rather than
+	// a zero-valued pointer or a panic.
+	deviceAttrs := []map[uint16][]byte{{dpllAID: u32Bytes(3)}}
+	info := buildDevDPLLInfo(deviceAttrs, nil, "ts")
+	if len(info.DPLLs) != 1 {
+		t.Fatalf("len(DPLLs) = %d, want 1", len(info.DPLLs))
+	}
+	if info.DPLLs[0].TempMilliC != nil {
+		t.Errorf("TempMilliC = %v, want nil", info.DPLLs[0].TempMilliC)
+	}
+}
+
+func TestFilterDPLLDumpForInterface(t *testing.T) {
+	// Two DPLL devices on the host (e.g. a dual-E810 box), each with
+	// one pin. Filtering for pin 20 (owned by dpll 2) must return only
+	// dpll 2 and pin 20, never dpll 1's data.
+	deviceAttrs := []map[uint16][]byte{
+		{dpllAID: u32Bytes(1)},
+		{dpllAID: u32Bytes(2)},
+	}
+	pinAttrs := []map[uint16][]byte{
+		{dpllAPinID: u32Bytes(10), dpllAPinParentID: u32Bytes(1)},
+		{dpllAPinID: u32Bytes(20), dpllAPinParentID: u32Bytes(2)},
+	}
+
+	devices, pins, err := filterDPLLDumpForInterface(deviceAttrs, pinAttrs, 20)
+	if err != nil {
+		t.Fatalf("filterDPLLDumpForInterface() unexpected error: %v", err)
+	}
+	if len(devices) != 1 || binary.LittleEndian.Uint32(devices[0][dpllAID]) != 2 {
+		t.Errorf("devices = %v, want just dpll 2", devices)
+	}
+	if len(pins) != 1 || binary.LittleEndian.Uint32(pins[0][dpllAPinID]) != 20 {
+		t.Errorf("pins = %v, want just pin 20", pins)
+	}
+}
+
+func TestFilterDPLLDumpForInterfaceUnknownPin(t *testing.T) {
+	_, _, err := filterDPLLDumpForInterface(nil, nil, 99)
+	if err == nil {
+		t.Error("filterDPLLDumpForInterface() = nil error, want one for an unmatched pin")
+	}
+}
@@ -0,0 +1,352 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package devices
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/redhat-partner-solutions/vse-sync-testsuite/pkg/callbacks"
+	"github.com/redhat-partner-solutions/vse-sync-testsuite/pkg/clients"
+)
+
+// gnssReadBytes bounds how much of the GNSS character device we read
+// per collection cycle: enough for a handful of NMEA sentences or a
+// couple of UBX frames. It bounds bytes, not time: on a device that has
+// stopped producing output the read waits until goCtx ends.
+const gnssReadBytes = 4096
+
+// GNSSStatus is the live health of a GNSS receiver, built by reading
+// and parsing whatever NMEA or u-blox UBX traffic is on its device node
+// during one bounded read.
+type GNSSStatus struct {
+	Timestamp        string  `json:"date"`
+	FixMode          string  `json:"fixMode"`
+	FixQuality       string  `json:"fixQuality"`
+	SatellitesInView int     `json:"satellitesInView"`
+	SatellitesInUse  int     `json:"satellitesInUse"`
+	Latitude         float64 `json:"latitude"`
+	Longitude        float64 `json:"longitude"`
+	HDOP             float64 `json:"hdop"`
+	AntennaStatus    string  `json:"antennaStatus"`
+	JammingIndicator int     `json:"jammingIndicator"`
+}
+
+// AnalyserJSON returns the json expected by the analysers
+func (gnss *GNSSStatus) AnalyserJSON() ([]byte, error) {
+	line, err := json.Marshal(&callbacks.AnalyserFormatType{
+		ID: "gnss/status",
+		Data: []string{
+			gnss.Timestamp,
+			gnss.FixMode,
+			gnss.FixQuality,
+			strconv.Itoa(gnss.SatellitesInView),
+			strconv.Itoa(gnss.SatellitesInUse),
+			fmt.Sprintf("%f", gnss.Latitude),
+			fmt.Sprintf("%f", gnss.Longitude),
+			fmt.Sprintf("%f", gnss.HDOP),
+			gnss.AntennaStatus,
+			strconv.Itoa(gnss.JammingIndicator),
+		},
+	})
+	if err != nil {
+		return []byte{}, fmt.Errorf("failed to marshal Analyser format for gnssStatus %w", err)
+	}
+	return line, nil
+}
+
+// gnssRawFields is the single raw-bytes command used to pull a window
+// of traffic off a GNSS device node, ahead of parsing it in Go.
+type gnssRawFields struct {
+	Raw string `fetcherKey:"raw"`
+}
+
+// GetGNSSStatus reads a bounded window from gnssDevPath (as returned in
+// PTPDeviceInfo.GNSSDev) inside ctx and parses whatever NMEA/UBX traffic
+// it finds into a GNSSStatus. goCtx bounds how long the underlying
+// clients.Cmd execution may run.
+func GetGNSSStatus(goCtx context.Context, ctx clients.ContainerContext, gnssDevPath, timestamp string) (GNSSStatus, error) {
+	fetcherInst := NewFetcher()
+	err := fetcherInst.AddNewCommand(
+		"raw",
+		fmt.Sprintf("head -c %d %s", gnssReadBytes, gnssDevPath),
+		true,
+	)
+	if err != nil {
+		return GNSSStatus{}, fmt.Errorf("failed to add command for gnss status %w", err)
+	}
+
+	fields := gnssRawFields{}
+	if err := fetcherInst.Fetch(goCtx, ctx, &fields); err != nil {
+		return GNSSStatus{}, fmt.Errorf("failed to read gnss device %s: %w", gnssDevPath, err)
+	}
+
+	status := GNSSStatus{Timestamp: timestamp}
+	parseGNSSStream([]byte(fields.Raw), &status)
+	return status, nil
+}
+
+// parseGNSSStream walks raw, dispatching each NMEA/PUBX sentence and
+// each UBX binary frame it can find to the matching parser. Unknown or
+// malformed content is skipped rather than treated as fatal: a window
+// read off a live device node routinely starts or ends mid-sentence.
+func parseGNSSStream(raw []byte, status *GNSSStatus) {
+	for _, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "$") {
+			parseNMEASentence(line, status)
+		}
+	}
+	parseUBXFrames(raw, status)
+}
+
+// parseNMEASentence validates the trailing "*XX" checksum (the XOR of
+// every byte between '$' and '*') and, if it matches, dispatches on the
+// sentence's talker-independent suffix.
+func parseNMEASentence(sentence string, status *GNSSStatus) {
+	body, checksum, ok := strings.Cut(strings.TrimPrefix(sentence, "$"), "*")
+	if !ok || len(checksum) < 2 {
+		return
+	}
+	want, err := strconv.ParseUint(checksum[:2], 16, 8)
+	if err != nil {
+		return
+	}
+	got := byte(0)
+	for i := 0; i < len(body); i++ {
+		got ^= body[i]
+	}
+	if byte(want) != got {
+		log.Errorf("discarding NMEA sentence with bad checksum: %s", sentence)
+		return
+	}
+
+	fields := strings.Split(body, ",")
+	if len(fields) == 0 {
+		return
+	}
+	switch {
+	case strings.HasSuffix(fields[0], "GGA"):
+		parseGGA(fields, status)
+	case strings.HasSuffix(fields[0], "GSA"):
+		parseGSA(fields, status)
+	case strings.HasSuffix(fields[0], "GSV"):
+		parseGSV(fields, status)
+	case strings.HasSuffix(fields[0], "RMC"):
+		parseRMC(fields, status)
+	case fields[0] == "PUBX" && len(fields) > 1 && fields[1] == "00":
+		parsePUBX00(fields, status)
+	case fields[0] == "PUBX" && len(fields) > 1 && fields[1] == "03":
+		parsePUBX03(fields, status)
+	}
+}
+
+// nmeaFloat parses an NMEA numeric field, treating the empty fields a
+// receiver emits without a fix as zero rather than an error.
+func nmeaFloat(field string) float64 {
+	if field == "" {
+		return 0
+	}
+	value, err := strconv.ParseFloat(field, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// nmeaCoordinate converts an NMEA ddmm.mmmm/dddmm.mmmm field plus
+// hemisphere letter into signed decimal degrees. The minutes are always
+// the last two integer digits plus the fraction, so latitude's ddmm and
+// longitude's dddmm need no separate handling.
+func nmeaCoordinate(field, hemisphere string) float64 {
+	raw := nmeaFloat(field)
+	if raw == 0 {
+		return 0
+	}
+	degrees := float64(int(raw) / 100)
+	minutes := raw - degrees*100
+	value := degrees + minutes/60
+	if hemisphere == "S" || hemisphere == "W" {
+		value = -value
+	}
+	return value
+}
+
+// parseGGA extracts fix quality, satellite count, HDOP and position
+// from a $GxGGA sentence.
+func parseGGA(fields []string, status *GNSSStatus) {
+	if len(fields) < 9 {
+		return
+	}
+	status.Latitude = nmeaCoordinate(fields[2], fields[3])
+	status.Longitude = nmeaCoordinate(fields[4], fields[5])
+	status.FixQuality = fields[6]
+	status.SatellitesInUse = int(nmeaFloat(fields[7]))
+	status.HDOP = nmeaFloat(fields[8])
+}
+
+// parseGSA extracts the 2D/3D fix mode from a $GxGSA sentence.
+func parseGSA(fields []string, status *GNSSStatus) {
+	if len(fields) < 3 {
+		return
+	}
+	switch fields[2] {
+	case "2":
+		status.FixMode = "2D"
+	case "3":
+		status.FixMode = "3D"
+	default:
+		status.FixMode = "no-fix"
+	}
+}
+
+// parseGSV extracts satellites-in-view from a $GxGSV sentence.
+func parseGSV(fields []string, status *GNSSStatus) {
+	if len(fields) < 4 {
+		return
+	}
+	status.SatellitesInView = int(nmeaFloat(fields[3]))
+}
+
+// parseRMC extracts position from a $GxRMC sentence, for receivers that
+// don't also emit GGA.
+func parseRMC(fields []string, status *GNSSStatus) {
+	if len(fields) < 7 {
+		return
+	}
+	status.Latitude = nmeaCoordinate(fields[3], fields[4])
+	status.Longitude = nmeaCoordinate(fields[5], fields[6])
+}
+
+// parsePUBX00 extracts u-blox navigation status (fix mode) from a
+// proprietary $PUBX,00 sentence.
+func parsePUBX00(fields []string, status *GNSSStatus) {
+	if len(fields) < 9 {
+		return
+	}
+	status.Latitude = nmeaCoordinate(fields[3], fields[4])
+	status.Longitude = nmeaCoordinate(fields[5], fields[6])
+	switch fields[8] {
+	case "NF":
+		status.FixMode = "no-fix"
+	case "DR", "G2", "G3", "D2", "D3":
+		status.FixMode = fields[8]
+	}
+}
+
+// parsePUBX03 extracts satellites-in-view from a proprietary $PUBX,03
+// sentence: field 1 is the "03" sentence-subtype marker, field 2 is
+// the satellite count, one group of fields follows per satellite.
+func parsePUBX03(fields []string, status *GNSSStatus) {
+	if len(fields) < 3 {
+		return
+	}
+	status.SatellitesInView = int(nmeaFloat(fields[2]))
+}
+
+const (
+	ubxSync1 = 0xB5
+	ubxSync2 = 0x62
+
+	ubxClassNav = 0x01
+	ubxIDNavPVT = 0x07
+
+	ubxClassMon = 0x0A
+	ubxIDMonHW  = 0x09
+
+	ubxHeaderLen   = 6 // sync(2) + class(1) + id(1) + length(2)
+	ubxChecksumLen = 2
+
+	navPVTFixTypeOffset = 20
+	navPVTNumSVOffset   = 23
+
+	monHWAntennaStatusOffset = 20
+	monHWJammingIndOffset    = 45
+)
+
+var navPVTFixTypeNames = map[byte]string{
+	0: "no-fix",
+	1: "dead-reckoning",
+	2: "2D",
+	3: "3D",
+	4: "gnss+dead-reckoning",
+	5: "time-only",
+}
+
+var monHWAntennaStatusNames = map[byte]string{
+	0: "init",
+	1: "unknown",
+	2: "ok",
+	3: "short",
+	4: "open",
+}
+
+// parseUBXFrames scans raw for "\xB5\x62"-prefixed UBX frames and
+// dispatches the ones this package understands (NAV-PVT, MON-HW).
+// Frames that fail their Fletcher-8 checksum, or run past the end of
+// raw, are skipped: a bounded window read off a live device routinely
+// starts or ends mid-frame.
+func parseUBXFrames(raw []byte, status *GNSSStatus) {
+	for i := 0; i+ubxHeaderLen <= len(raw); i++ {
+		if raw[i] != ubxSync1 || raw[i+1] != ubxSync2 {
+			continue
+		}
+		class := raw[i+2]
+		id := raw[i+3]
+		length := int(binary.LittleEndian.Uint16(raw[i+4 : i+6]))
+		payloadStart := i + ubxHeaderLen
+		payloadEnd := payloadStart + length
+		if payloadEnd+ubxChecksumLen > len(raw) {
+			continue
+		}
+		payload := raw[payloadStart:payloadEnd]
+		if !verifyUBXChecksum(raw[i+2:payloadEnd], raw[payloadEnd:payloadEnd+ubxChecksumLen]) {
+			continue
+		}
+
+		switch {
+		case class == ubxClassNav && id == ubxIDNavPVT:
+			parseUBXNavPVT(payload, status)
+		case class == ubxClassMon && id == ubxIDMonHW:
+			parseUBXMonHW(payload, status)
+		}
+		i = payloadEnd + ubxChecksumLen - 1
+	}
+}
+
+// verifyUBXChecksum implements the UBX Fletcher-8 checksum, computed
+// over the class, id, length and payload bytes.
+func verifyUBXChecksum(data []byte, checksum []byte) bool {
+	var checkA, checkB byte
+	for _, b := range data {
+		checkA += b
+		checkB += checkA
+	}
+	return len(checksum) == ubxChecksumLen && checksum[0] == checkA && checksum[1] == checkB
+}
+
+// parseUBXNavPVT extracts fix type and satellites-used from a
+// UBX-NAV-PVT payload.
+func parseUBXNavPVT(payload []byte, status *GNSSStatus) {
+	if len(payload) <= navPVTNumSVOffset {
+		return
+	}
+	status.FixMode = navPVTFixTypeNames[payload[navPVTFixTypeOffset]]
+	status.SatellitesInUse = int(payload[navPVTNumSVOffset])
+}
+
+// parseUBXMonHW extracts antenna status and jamming indicator from a
+// UBX-MON-HW payload.
+func parseUBXMonHW(payload []byte, status *GNSSStatus) {
+	if len(payload) <= monHWJammingIndOffset {
+		return
+	}
+	status.AntennaStatus = monHWAntennaStatusNames[payload[monHWAntennaStatusOffset]]
+	status.JammingIndicator = int(payload[monHWJammingIndOffset])
+}
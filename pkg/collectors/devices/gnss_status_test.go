@@ -0,0 +1,251 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package devices
+
+import (
+	"math"
+	"testing"
+)
+
+// coordinateTolerance absorbs the last-place rounding difference between
+// nmeaCoordinate's float64 arithmetic and an exactly evaluated constant.
+const coordinateTolerance = 1e-9
+
+func TestParseNMEASentenceChecksum(t *testing.T) {
+	tests := []struct {
+		name         string
+		sentence     string
+		wantFixMode  string
+		wantDiscard  bool
+		wantSatsView int
+	}{
+		{
+			name:         "good checksum is parsed",
+			sentence:     "$GPGSV,3,1,11,10,63,137,17*4C",
+			wantSatsView: 11,
+		},
+		{
+			name:        "bad checksum is discarded",
+			sentence:    "$GPGSV,3,1,11,10,63,137,17*4D",
+			wantDiscard: true,
+		},
+		{
+			name:        "missing checksum separator is discarded",
+			sentence:    "$GPGSV,3,1,11,10,63,137,17",
+			wantDiscard: true,
+		},
+		{
+			name:        "non-hex checksum is discarded",
+			sentence:    "$GPGSV,3,1,11,10,63,137,17*ZZ",
+			wantDiscard: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := &GNSSStatus{}
+			parseNMEASentence(test.sentence, status)
+			if test.wantDiscard {
+				if status.SatellitesInView != 0 {
+					t.Errorf("SatellitesInView = %d, want 0 for a discarded sentence", status.SatellitesInView)
+				}
+				return
+			}
+			if status.SatellitesInView != test.wantSatsView {
+				t.Errorf("SatellitesInView = %d, want %d", status.SatellitesInView, test.wantSatsView)
+			}
+		})
+	}
+}
+
+func TestParseGGA(t *testing.T) {
+	status := &GNSSStatus{}
+	fields := []string{
+		"GPGGA", "123519", "4807.038", "N", "01131.000", "E", "1", "08", "0.9", "545.4", "M", "46.9", "M", "", "",
+	}
+	parseGGA(fields, status)
+
+	if status.FixQuality != "1" {
+		t.Errorf("FixQuality = %q, want %q", status.FixQuality, "1")
+	}
+	if status.SatellitesInUse != 8 {
+		t.Errorf("SatellitesInUse = %d, want 8", status.SatellitesInUse)
+	}
+	if status.HDOP != 0.9 {
+		t.Errorf("HDOP = %v, want 0.9", status.HDOP)
+	}
+	wantLat, wantLon := 48+7.038/60, 11+31.000/60
+	if math.Abs(status.Latitude-wantLat) > coordinateTolerance {
+		t.Errorf("Latitude = %v, want %v", status.Latitude, wantLat)
+	}
+	if status.Longitude != wantLon {
+		t.Errorf("Longitude = %v, want %v", status.Longitude, wantLon)
+	}
+}
+
+func TestParseGGATooShort(t *testing.T) {
+	status := &GNSSStatus{}
+	parseGGA([]string{"GPGGA", "123519"}, status)
+	if status.FixQuality != "" {
+		t.Errorf("FixQuality = %q, want unchanged empty string", status.FixQuality)
+	}
+}
+
+func TestNmeaCoordinate(t *testing.T) {
+	tests := []struct {
+		name       string
+		field      string
+		hemisphere string
+		want       float64
+	}{
+		{"empty field is zero", "", "N", 0},
+		{"north stays positive", "4807.038", "N", 48 + 7.038/60},
+		{"south is negated", "4807.038", "S", -(48 + 7.038/60)},
+		{"east stays positive", "01131.000", "E", 11 + 31.000/60},
+		{"west is negated", "01131.000", "W", -(11 + 31.000/60)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := nmeaCoordinate(test.field, test.hemisphere); math.Abs(got-test.want) > coordinateTolerance {
+				t.Errorf("nmeaCoordinate(%q, %q) = %v, want %v", test.field, test.hemisphere, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseGSA(t *testing.T) {
+	tests := []struct {
+		name       string
+		fixField   string
+		wantMode   string
+		shortInput bool
+	}{
+		{name: "2D fix", fixField: "2", wantMode: "2D"},
+		{name: "3D fix", fixField: "3", wantMode: "3D"},
+		{name: "no fix", fixField: "1", wantMode: "no-fix"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := &GNSSStatus{}
+			parseGSA([]string{"GPGSA", "A", test.fixField}, status)
+			if status.FixMode != test.wantMode {
+				t.Errorf("FixMode = %q, want %q", status.FixMode, test.wantMode)
+			}
+		})
+	}
+}
+
+func TestParsePUBX00(t *testing.T) {
+	status := &GNSSStatus{}
+	fields := []string{
+		"PUBX", "00", "121042.00", "4807.038", "N", "01131.000", "E", "10.2", "G3", "4",
+	}
+	parsePUBX00(fields, status)
+	if status.FixMode != "G3" {
+		t.Errorf("FixMode = %q, want %q", status.FixMode, "G3")
+	}
+	wantLat := 48 + 7.038/60
+	if math.Abs(status.Latitude-wantLat) > coordinateTolerance {
+		t.Errorf("Latitude = %v, want %v", status.Latitude, wantLat)
+	}
+}
+
+func TestParsePUBX03(t *testing.T) {
+	status := &GNSSStatus{}
+	parsePUBX03([]string{"PUBX", "03", "7"}, status)
+	if status.SatellitesInView != 7 {
+		t.Errorf("SatellitesInView = %d, want 7", status.SatellitesInView)
+	}
+}
+
+// buildUBXFrame assembles a complete UBX frame (sync + class + id +
+// length + payload + Fletcher-8 checksum), mirroring what a receiver
+// puts on the wire, so tests exercise parseUBXFrames end to end rather
+// than calling the per-message parsers directly.
+func buildUBXFrame(class, id byte, payload []byte) []byte {
+	frame := []byte{ubxSync1, ubxSync2, class, id, byte(len(payload)), byte(len(payload) >> 8)}
+	frame = append(frame, payload...)
+	var checkA, checkB byte
+	for _, b := range frame[2:] {
+		checkA += b
+		checkB += checkA
+	}
+	return append(frame, checkA, checkB)
+}
+
+func TestParseUBXFramesNavPVT(t *testing.T) {
+	payload := make([]byte, navPVTNumSVOffset+1)
+	payload[navPVTFixTypeOffset] = 3 // 3D
+	payload[navPVTNumSVOffset] = 12
+
+	status := &GNSSStatus{}
+	parseUBXFrames(buildUBXFrame(ubxClassNav, ubxIDNavPVT, payload), status)
+
+	if status.FixMode != "3D" {
+		t.Errorf("FixMode = %q, want %q", status.FixMode, "3D")
+	}
+	if status.SatellitesInUse != 12 {
+		t.Errorf("SatellitesInUse = %d, want 12", status.SatellitesInUse)
+	}
+}
+
+func TestParseUBXFramesMonHW(t *testing.T) {
+	payload := make([]byte, monHWJammingIndOffset+1)
+	payload[monHWAntennaStatusOffset] = 2 // ok
+	payload[monHWJammingIndOffset] = 5
+
+	status := &GNSSStatus{}
+	parseUBXFrames(buildUBXFrame(ubxClassMon, ubxIDMonHW, payload), status)
+
+	if status.AntennaStatus != "ok" {
+		t.Errorf("AntennaStatus = %q, want %q", status.AntennaStatus, "ok")
+	}
+	if status.JammingIndicator != 5 {
+		t.Errorf("JammingIndicator = %d, want 5", status.JammingIndicator)
+	}
+}
+
+func TestParseUBXFramesBadChecksumIsSkipped(t *testing.T) {
+	payload := make([]byte, navPVTNumSVOffset+1)
+	payload[navPVTFixTypeOffset] = 3
+	payload[navPVTNumSVOffset] = 12
+	frame := buildUBXFrame(ubxClassNav, ubxIDNavPVT, payload)
+	frame[len(frame)-1] ^= 0xFF // corrupt checksum byte B
+
+	status := &GNSSStatus{}
+	parseUBXFrames(frame, status)
+
+	if status.FixMode != "" || status.SatellitesInUse != 0 {
+		t.Errorf("status = %+v, want untouched for a corrupted frame", status)
+	}
+}
+
+func TestParseUBXFramesTruncatedFrameIsSkipped(t *testing.T) {
+	payload := make([]byte, navPVTNumSVOffset+1)
+	frame := buildUBXFrame(ubxClassNav, ubxIDNavPVT, payload)
+
+	status := &GNSSStatus{}
+	parseUBXFrames(frame[:len(frame)-1], status) // drop the trailing checksum byte
+
+	if status.FixMode != "" {
+		t.Errorf("FixMode = %q, want unchanged for a truncated frame", status.FixMode)
+	}
+}
+
+func TestVerifyUBXChecksum(t *testing.T) {
+	data := []byte{ubxClassNav, ubxIDNavPVT, 0x02, 0x00, 0x01, 0x02}
+	var checkA, checkB byte
+	for _, b := range data {
+		checkA += b
+		checkB += checkA
+	}
+
+	if !verifyUBXChecksum(data, []byte{checkA, checkB}) {
+		t.Error("verifyUBXChecksum() = false, want true for a correctly computed checksum")
+	}
+	if verifyUBXChecksum(data, []byte{checkA ^ 0x01, checkB}) {
+		t.Error("verifyUBXChecksum() = true, want false for a corrupted checksum")
+	}
+	if verifyUBXChecksum(data, []byte{checkA}) {
+		t.Error("verifyUBXChecksum() = true, want false for a short checksum")
+	}
+}
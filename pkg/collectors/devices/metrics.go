@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package devices
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/redhat-partner-solutions/vse-sync-testsuite/pkg/clients"
+)
+
+// defaultScrapeTimeout bounds a plain Collect call, which has no
+// request to take a deadline from. A scrape served through
+// RequestCollector is bounded by the context it was built with instead.
+const defaultScrapeTimeout = 10 * time.Second
+
+var (
+	dpllLockStateDesc = prometheus.NewDesc(
+		"vse_dpll_lock_state",
+		"Current DPLL lock status, as the kernel DPLL_A_LOCK_STATUS code (0 unset, 1 unlocked, 2 locked, 3 locked-ho-acq, 4 holdover).",
+		[]string{"iface", "dpll", "type"}, nil,
+	)
+	dpllPPSOffsetSecondsDesc = prometheus.NewDesc(
+		"vse_dpll_pps_offset_seconds",
+		"Phase offset of a DPLL's pin, in seconds.",
+		[]string{"iface", "dpll"}, nil,
+	)
+	gnssSatellitesUsedDesc = prometheus.NewDesc(
+		"vse_gnss_satellites_used",
+		"Number of satellites used in the GNSS receiver's current fix.",
+		[]string{"iface"}, nil,
+	)
+	ptpDeviceInfoDesc = prometheus.NewDesc(
+		"vse_ptp_device_info",
+		"PTP device identity; an info metric, constant value 1.",
+		[]string{"iface", "vendor", "device", "gnss"}, nil,
+	)
+)
+
+// ifaceSnapshot is the result of one collection cycle for an interface,
+// cached so a scrape storm doesn't re-exec into the target node for
+// every request within minScrapeInterval.
+type ifaceSnapshot struct {
+	at       time.Time
+	dpllInfo DevDPLLInfo
+	ptpInfo  PTPDeviceInfo
+}
+
+// DeviceMetricsCollector is a prometheus.Collector that reports
+// PTPDeviceInfo, DevDPLLInfo and GNSS status for a fixed set of
+// interfaces, fetched on demand by Collect rather than polled in the
+// background.
+type DeviceMetricsCollector struct {
+	ctx        clients.ContainerContext
+	interfaces []string
+
+	// minScrapeInterval rate-limits the underlying clients.Cmd
+	// execution per interface: within this window of the last
+	// collection a new scrape is served the cached snapshot instead
+	// of triggering another oc exec.
+	minScrapeInterval time.Duration
+
+	mu    sync.Mutex
+	cache map[string]ifaceSnapshot
+
+	// inflight holds one lock per interface currently being fetched, so
+	// concurrent scrapes landing inside the same minScrapeInterval
+	// window collapse into a single underlying fetch instead of each
+	// firing their own oc exec.
+	inflight map[string]*sync.Mutex
+}
+
+// NewDeviceMetricsCollector builds a collector for interfaces, using
+// ctx for the underlying container-exec calls. minScrapeInterval of
+// zero disables rate-limiting.
+func NewDeviceMetricsCollector(
+	ctx clients.ContainerContext, interfaces []string, minScrapeInterval time.Duration,
+) *DeviceMetricsCollector {
+	return &DeviceMetricsCollector{
+		ctx:               ctx,
+		interfaces:        interfaces,
+		minScrapeInterval: minScrapeInterval,
+		cache:             make(map[string]ifaceSnapshot),
+		inflight:          make(map[string]*sync.Mutex),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (collector *DeviceMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dpllLockStateDesc
+	ch <- dpllPPSOffsetSecondsDesc
+	ch <- gnssSatellitesUsedDesc
+	ch <- ptpDeviceInfoDesc
+}
+
+// Collect implements prometheus.Collector, bounding its clients.Cmd
+// executions by defaultScrapeTimeout. A caller that needs a
+// request-specific deadline (e.g. the HTTP handler honouring the
+// scrape's own timeout) should use RequestCollector instead, which
+// calls CollectWithContext with a context scoped to that request.
+func (collector *DeviceMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	goCtx, cancel := WithTimeout(context.Background(), defaultScrapeTimeout)
+	defer cancel()
+	collector.CollectWithContext(goCtx, ch)
+}
+
+// CollectWithContext does the work of Collect, bounded by goCtx rather
+// than a fixed timeout. Keeping the timeout as an explicit parameter
+// here (instead of mutable state on collector) means concurrent
+// scrapes can each supply their own deadline without racing each
+// other's.
+func (collector *DeviceMetricsCollector) CollectWithContext(goCtx context.Context, ch chan<- prometheus.Metric) {
+	for _, interfaceName := range collector.interfaces {
+		snapshot := collector.snapshotFor(goCtx, interfaceName)
+
+		for _, dpll := range snapshot.dpllInfo.DPLLs {
+			ch <- prometheus.MustNewConstMetric(
+				dpllLockStateDesc, prometheus.GaugeValue, dpllLockStatusCode(dpll.LockStatus),
+				interfaceName, strconv.FormatUint(uint64(dpll.ID), 10), dpll.Type,
+			)
+		}
+		for _, pin := range snapshot.dpllInfo.Pins {
+			ch <- prometheus.MustNewConstMetric(
+				dpllPPSOffsetSecondsDesc, prometheus.GaugeValue, pin.PhaseOffset,
+				interfaceName, strconv.FormatUint(uint64(pin.ParentID), 10),
+			)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			gnssSatellitesUsedDesc, prometheus.GaugeValue, float64(snapshot.ptpInfo.GNSS.SatellitesInUse),
+			interfaceName,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			ptpDeviceInfoDesc, prometheus.GaugeValue, 1,
+			interfaceName, snapshot.ptpInfo.VendorID, snapshot.ptpInfo.DeviceID, snapshot.ptpInfo.GNSSDev,
+		)
+	}
+}
+
+// snapshotFor returns the cached snapshot for interfaceName if it's
+// younger than minScrapeInterval, otherwise fetches a fresh one.
+//
+// Concurrent scrapes for the same interface serialize on that
+// interface's inflight lock rather than each racing straight past the
+// cache check into their own fetch: the first caller in does the
+// fetch, and everyone else queued behind the lock picks up the
+// snapshot it just wrote instead of also hitting the target node.
+// Other interfaces are unaffected, since each gets its own lock.
+func (collector *DeviceMetricsCollector) snapshotFor(goCtx context.Context, interfaceName string) ifaceSnapshot {
+	if cached, ok := collector.freshSnapshot(interfaceName); ok {
+		return cached
+	}
+
+	ifaceLock := collector.lockFor(interfaceName)
+	ifaceLock.Lock()
+	defer ifaceLock.Unlock()
+
+	if cached, ok := collector.freshSnapshot(interfaceName); ok {
+		return cached
+	}
+
+	snapshot := ifaceSnapshot{at: time.Now()}
+	var err error
+	snapshot.dpllInfo, err = GetDevDPLLInfo(goCtx, collector.ctx, interfaceName)
+	if err != nil {
+		log.Errorf("failed to collect dpll metrics for %s: %s", interfaceName, err.Error())
+	}
+	snapshot.ptpInfo, err = GetPTPDeviceInfo(goCtx, interfaceName, collector.ctx)
+	if err != nil {
+		log.Errorf("failed to collect ptp device metrics for %s: %s", interfaceName, err.Error())
+	}
+
+	collector.mu.Lock()
+	collector.cache[interfaceName] = snapshot
+	collector.mu.Unlock()
+	return snapshot
+}
+
+// freshSnapshot returns the cached snapshot for interfaceName and true
+// if it's younger than minScrapeInterval.
+func (collector *DeviceMetricsCollector) freshSnapshot(interfaceName string) (ifaceSnapshot, bool) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	cached, ok := collector.cache[interfaceName]
+	fresh := ok && collector.minScrapeInterval > 0 && time.Since(cached.at) < collector.minScrapeInterval
+	return cached, fresh
+}
+
+// lockFor returns the per-interface inflight lock for interfaceName,
+// creating it on first use.
+func (collector *DeviceMetricsCollector) lockFor(interfaceName string) *sync.Mutex {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	ifaceLock, ok := collector.inflight[interfaceName]
+	if !ok {
+		ifaceLock = &sync.Mutex{}
+		collector.inflight[interfaceName] = ifaceLock
+	}
+	return ifaceLock
+}
+
+// RequestCollector adapts a DeviceMetricsCollector to prometheus.Collector
+// using a context scoped to a single HTTP request, so a scrape's
+// deadline (and its reaction to the client disconnecting) is carried
+// as a plain value rather than shared mutable state that concurrent
+// scrapes could race over.
+type RequestCollector struct {
+	collector *DeviceMetricsCollector
+	goCtx     context.Context
+}
+
+// NewRequestCollector returns a prometheus.Collector that delegates to
+// collector's snapshot cache but bounds its clients.Cmd executions by
+// goCtx, typically WithTimeout(r.Context(), ...) for the scrape that's
+// currently being served.
+func NewRequestCollector(collector *DeviceMetricsCollector, goCtx context.Context) *RequestCollector {
+	return &RequestCollector{collector: collector, goCtx: goCtx}
+}
+
+// Describe implements prometheus.Collector.
+func (rc *RequestCollector) Describe(ch chan<- *prometheus.Desc) {
+	rc.collector.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (rc *RequestCollector) Collect(ch chan<- prometheus.Metric) {
+	rc.collector.CollectWithContext(rc.goCtx, ch)
+}
@@ -0,0 +1,267 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package devices
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// This file holds the small slice of generic netlink (genetlink) framing
+// that the DPLL collector needs: building a request message, sending it
+// and collecting a (possibly multi-message) dump reply, and walking the
+// resulting nlattr TLV list. It deliberately doesn't aim to be a general
+// purpose netlink library -- just enough to talk to one kernel family.
+
+const (
+	nlmsgHeaderLen  = 16 // struct nlmsghdr
+	genlHeaderLen   = 4  // struct genlmsghdr
+	nlaHeaderLen    = 4  // struct nlattr
+	nlaAlignTo      = 4
+	defaultGenlSize = 1024
+)
+
+// nlAttr is a single netlink attribute to encode into a request.
+type nlAttr struct {
+	Type  uint16
+	Value []byte
+}
+
+// nullTerminate returns s as a NUL-terminated byte slice, the form
+// genetlink string attributes (e.g. CTRL_ATTR_FAMILY_NAME) are expected
+// to be encoded in.
+func nullTerminate(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+func nlaAlign(length int) int {
+	return (length + nlaAlignTo - 1) &^ (nlaAlignTo - 1)
+}
+
+// encodeAttrs serializes attrs as a flat nlattr TLV list, the form
+// parseAttrs expects to read back (and, nested inside another attr's
+// Value, the form a nested attribute like CTRL_ATTR_MCAST_GROUPS takes).
+func encodeAttrs(attrs []nlAttr) []byte {
+	var body []byte
+	for _, attr := range attrs {
+		header := make([]byte, nlaHeaderLen)
+		binary.LittleEndian.PutUint16(header[0:2], uint16(nlaHeaderLen+len(attr.Value)))
+		binary.LittleEndian.PutUint16(header[2:4], attr.Type)
+		body = append(body, header...)
+		body = append(body, attr.Value...)
+		if pad := nlaAlign(len(attr.Value)) - len(attr.Value); pad > 0 {
+			body = append(body, make([]byte, pad)...)
+		}
+	}
+	return body
+}
+
+// buildGenlMessage assembles a complete nlmsghdr + genlmsghdr + attrs
+// request ready to be written to a NETLINK_GENERIC socket.
+func buildGenlMessage(familyID uint16, cmd uint8, attrs []nlAttr) []byte {
+	body := make([]byte, genlHeaderLen)
+	body[0] = cmd
+	body[1] = 1 // version
+	body = append(body, encodeAttrs(attrs)...)
+
+	msg := make([]byte, nlmsgHeaderLen)
+	binary.LittleEndian.PutUint32(msg[0:4], uint32(nlmsgHeaderLen+len(body)))
+	binary.LittleEndian.PutUint16(msg[4:6], familyID)
+	binary.LittleEndian.PutUint16(msg[6:8], unix.NLM_F_REQUEST|unix.NLM_F_ACK)
+	// seq/pid (bytes 8:16) are left zero; the kernel doesn't require a
+	// per-request sequence number for the synchronous request/reply
+	// pattern used here.
+	return append(msg, body...)
+}
+
+// armSocketDeadline sets SO_RCVTIMEO/SO_SNDTIMEO on fd from goCtx's
+// deadline, so a blocking read/write on a netlink socket is bounded by
+// the caller's context rather than however long the kernel takes to
+// reply (or forever, if it never does). A goCtx with no deadline (e.g.
+// context.Background()) leaves the socket blocking, matching the
+// original behaviour. It returns context.DeadlineExceeded immediately,
+// without touching the socket, if the deadline has already passed.
+func armSocketDeadline(goCtx context.Context, fd int) error {
+	deadlineAt, ok := goCtx.Deadline()
+	if !ok {
+		return nil
+	}
+	remaining := time.Until(deadlineAt)
+	if remaining <= 0 {
+		return context.DeadlineExceeded
+	}
+	tv := unix.NsecToTimeval(remaining.Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		return fmt.Errorf("failed to arm netlink read deadline: %w", err)
+	}
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_SNDTIMEO, &tv); err != nil {
+		return fmt.Errorf("failed to arm netlink write deadline: %w", err)
+	}
+	return nil
+}
+
+// wrapNetlinkTimeout turns the EAGAIN/EWOULDBLOCK a SO_RCVTIMEO expiry
+// surfaces as into whichever goCtx error actually caused it, so
+// callers see "context deadline exceeded" (or "context canceled")
+// rather than a bare, uninformative errno.
+func wrapNetlinkTimeout(goCtx context.Context, msg string, err error) error {
+	if errors.Is(err, unix.EAGAIN) && goCtx.Err() != nil {
+		return fmt.Errorf("%s: %w", msg, goCtx.Err())
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// readNetlinkMsg reads one atomic netlink datagram from fd, bounded by
+// goCtx. The buffer is sized exactly via MSG_PEEK|MSG_TRUNC rather
+// than assuming a fixed size fits: an RTM_GETLINK reply for an SR-IOV
+// capable NIC (IFLA_VFINFO_LIST, IFLA_STATS64, IFLA_AF_SPEC, queue
+// counts, ...) routinely runs past defaultGenlSize, and the kernel
+// doesn't truncate nlmsg_len to fit a small recvmsg buffer.
+func readNetlinkMsg(goCtx context.Context, fd int) ([]byte, error) {
+	if err := armSocketDeadline(goCtx, fd); err != nil {
+		return nil, err
+	}
+	peek := make([]byte, defaultGenlSize)
+	n, _, err := unix.Recvfrom(fd, peek, unix.MSG_PEEK|unix.MSG_TRUNC)
+	if err != nil {
+		return nil, wrapNetlinkTimeout(goCtx, "failed to size netlink reply", err)
+	}
+	buf := peek
+	if n > len(peek) {
+		buf = make([]byte, n)
+	}
+	n, err = unix.Read(fd, buf)
+	if err != nil {
+		return nil, wrapNetlinkTimeout(goCtx, "failed to read netlink reply", err)
+	}
+	return buf[:n], nil
+}
+
+// requestReply sends req and returns the first non-error, non-done
+// reply payload (header stripped down to the genlmsghdr), bounded by
+// goCtx.
+func (conn *dpllNetlinkConn) requestReply(goCtx context.Context, req []byte) ([]byte, error) {
+	if err := armSocketDeadline(goCtx, conn.fd); err != nil {
+		return nil, err
+	}
+	if _, err := unix.Write(conn.fd, req); err != nil {
+		return nil, wrapNetlinkTimeout(goCtx, "failed to write netlink request", err)
+	}
+	// A datagram carrying only an ACK (e.g. one left over from an
+	// earlier NLM_F_ACK request on this socket) holds no payload; keep
+	// reading until one that does arrives.
+	for {
+		buf, err := readNetlinkMsg(goCtx, conn.fd)
+		if err != nil {
+			return nil, err
+		}
+		msgs, _, err := splitNlMsgs(buf)
+		if err != nil {
+			return nil, err
+		}
+		if len(msgs) > 0 {
+			return msgs[0], nil
+		}
+	}
+}
+
+// dump sends req (expected to carry NLM_F_DUMP semantics for DPLL_CMD_*
+// commands, which are dump-only) and collects every reply message until
+// NLMSG_DONE, returning one attribute map per message, bounded by
+// goCtx.
+func (conn *dpllNetlinkConn) dump(goCtx context.Context, req []byte) ([]map[uint16][]byte, error) {
+	binary.LittleEndian.PutUint16(req[6:8], unix.NLM_F_REQUEST|unix.NLM_F_DUMP)
+	if err := armSocketDeadline(goCtx, conn.fd); err != nil {
+		return nil, err
+	}
+	if _, err := unix.Write(conn.fd, req); err != nil {
+		return nil, wrapNetlinkTimeout(goCtx, "failed to write netlink dump request", err)
+	}
+
+	var results []map[uint16][]byte
+	for {
+		buf, err := readNetlinkMsg(goCtx, conn.fd)
+		if err != nil {
+			return nil, err
+		}
+		msgs, done, err := splitNlMsgs(buf)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			attrs, err := parseAttrs(m[genlHeaderLen:])
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, attrs)
+		}
+		if done {
+			break
+		}
+	}
+	return results, nil
+}
+
+// parseSingleNlMsg strips the nlmsghdr from a single-message reply,
+// surfacing NLMSG_ERROR as a Go error.
+func parseSingleNlMsg(buf []byte) ([]byte, error) {
+	msgs, _, err := splitNlMsgs(buf)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("empty netlink reply")
+	}
+	return msgs[0], nil
+}
+
+// splitNlMsgs walks the nlmsghdr-framed messages in buf, returning the
+// genlmsghdr-onward payload of each non-error message plus whether an
+// NLMSG_DONE terminator was seen.
+func splitNlMsgs(buf []byte) ([][]byte, bool, error) {
+	var payloads [][]byte
+	done := false
+	for len(buf) >= nlmsgHeaderLen {
+		msgLen := binary.LittleEndian.Uint32(buf[0:4])
+		msgType := binary.LittleEndian.Uint16(buf[4:6])
+		if msgLen < nlmsgHeaderLen || int(msgLen) > len(buf) {
+			return nil, false, fmt.Errorf("malformed netlink message length %d", msgLen)
+		}
+		switch msgType {
+		case unix.NLMSG_DONE:
+			done = true
+		case unix.NLMSG_ERROR:
+			errno := int32(binary.LittleEndian.Uint32(buf[nlmsgHeaderLen : nlmsgHeaderLen+4]))
+			if errno != 0 {
+				return nil, false, fmt.Errorf("netlink error reply: %d", errno)
+			}
+		default:
+			payloads = append(payloads, buf[nlmsgHeaderLen:msgLen])
+		}
+		buf = buf[nlaAlign(int(msgLen)):]
+	}
+	return payloads, done, nil
+}
+
+// parseAttrs walks a flat nlattr TLV list, keyed by attribute type. It
+// does not recurse into nested attributes (e.g. per-pin lists nested
+// under a device), which callers needing that detail parse themselves
+// from the raw value.
+func parseAttrs(buf []byte) (map[uint16][]byte, error) {
+	attrs := make(map[uint16][]byte)
+	for len(buf) >= nlaHeaderLen {
+		attrLen := binary.LittleEndian.Uint16(buf[0:2])
+		attrType := binary.LittleEndian.Uint16(buf[2:4]) &^ unix.NLA_F_NESTED
+		if int(attrLen) < nlaHeaderLen || int(attrLen) > len(buf) {
+			return nil, fmt.Errorf("malformed netlink attribute length %d", attrLen)
+		}
+		attrs[attrType] = buf[nlaHeaderLen:attrLen]
+		buf = buf[nlaAlign(int(attrLen)):]
+	}
+	return attrs, nil
+}
@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package devices
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestNlaAlign(t *testing.T) {
+	tests := []struct {
+		name   string
+		length int
+		want   int
+	}{
+		{"zero", 0, 0},
+		{"already aligned", 4, 4},
+		{"one over", 5, 8},
+		{"one under", 3, 4},
+		{"two words", 8, 8},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := nlaAlign(test.length); got != test.want {
+				t.Errorf("nlaAlign(%d) = %d, want %d", test.length, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseAttrs(t *testing.T) {
+	tests := []struct {
+		name    string
+		buf     []byte
+		want    map[uint16][]byte
+		wantErr bool
+	}{
+		{
+			name: "single unpadded attribute",
+			buf:  encodeAttr(1, []byte{0xAA, 0xBB, 0xCC, 0xDD}),
+			want: map[uint16][]byte{1: {0xAA, 0xBB, 0xCC, 0xDD}},
+		},
+		{
+			name: "single attribute needing padding",
+			buf:  encodeAttr(2, []byte{0x01}),
+			want: map[uint16][]byte{2: {0x01}},
+		},
+		{
+			name: "multiple attributes",
+			buf:  append(encodeAttr(1, []byte{0x01}), encodeAttr(2, []byte{0x02, 0x03})...),
+			want: map[uint16][]byte{1: {0x01}, 2: {0x02, 0x03}},
+		},
+		{
+			name: "nested flag is masked off the type",
+			buf:  encodeAttr(3|unix.NLA_F_NESTED, []byte{0x01}),
+			want: map[uint16][]byte{3: {0x01}},
+		},
+		{
+			name:    "truncated header",
+			buf:     []byte{0x01, 0x00},
+			want:    map[uint16][]byte{},
+			wantErr: false,
+		},
+		{
+			name:    "length shorter than header",
+			buf:     []byte{0x02, 0x00, 0x01, 0x00},
+			wantErr: true,
+		},
+		{
+			name:    "length longer than remaining buffer",
+			buf:     []byte{0xFF, 0x00, 0x01, 0x00},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseAttrs(test.buf)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("parseAttrs() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAttrs() unexpected error: %v", err)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("parseAttrs() = %v, want %v", got, test.want)
+			}
+			for attrType, value := range test.want {
+				gotValue, ok := got[attrType]
+				if !ok {
+					t.Errorf("missing attribute %d", attrType)
+					continue
+				}
+				if string(gotValue) != string(value) {
+					t.Errorf("attribute %d = %v, want %v", attrType, gotValue, value)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildGenlMessageRoundTrip(t *testing.T) {
+	req := buildGenlMessage(7, 2, []nlAttr{
+		{Type: 1, Value: nullTerminate("dpll")},
+	})
+
+	msgLen := binary.LittleEndian.Uint32(req[0:4])
+	if int(msgLen) != len(req) {
+		t.Fatalf("nlmsghdr length = %d, want %d", msgLen, len(req))
+	}
+	familyID := binary.LittleEndian.Uint16(req[4:6])
+	if familyID != 7 {
+		t.Errorf("nlmsghdr type (family id) = %d, want 7", familyID)
+	}
+	flags := binary.LittleEndian.Uint16(req[6:8])
+	if flags != unix.NLM_F_REQUEST|unix.NLM_F_ACK {
+		t.Errorf("nlmsghdr flags = %#x, want REQUEST|ACK", flags)
+	}
+
+	genl := req[nlmsgHeaderLen:]
+	if genl[0] != 2 {
+		t.Errorf("genlmsghdr cmd = %d, want 2", genl[0])
+	}
+
+	attrs, err := parseAttrs(genl[genlHeaderLen:])
+	if err != nil {
+		t.Fatalf("parseAttrs() unexpected error: %v", err)
+	}
+	value, ok := attrs[1]
+	if !ok {
+		t.Fatalf("attribute 1 missing from %v", attrs)
+	}
+	if string(value) != "dpll\x00" {
+		t.Errorf("attribute 1 = %q, want %q", value, "dpll\x00")
+	}
+}
+
+func TestSplitNlMsgs(t *testing.T) {
+	okMsg := encodeNlMsg(unix.NLMSG_MIN_TYPE, []byte{0xDE, 0xAD})
+	doneMsg := encodeNlMsg(unix.NLMSG_DONE, nil)
+	errMsg := encodeNlMsgError(0)
+
+	t.Run("one message then done", func(t *testing.T) {
+		buf := append(append([]byte{}, okMsg...), doneMsg...)
+		msgs, done, err := splitNlMsgs(buf)
+		if err != nil {
+			t.Fatalf("splitNlMsgs() unexpected error: %v", err)
+		}
+		if !done {
+			t.Errorf("done = false, want true")
+		}
+		if len(msgs) != 1 || string(msgs[0]) != "\xDE\xAD" {
+			t.Errorf("msgs = %v, want one payload {0xDE, 0xAD}", msgs)
+		}
+	})
+
+	t.Run("ack-style error reply with errno zero is not an error", func(t *testing.T) {
+		_, _, err := splitNlMsgs(errMsg)
+		if err != nil {
+			t.Errorf("splitNlMsgs() unexpected error for errno 0: %v", err)
+		}
+	})
+
+	t.Run("non-zero errno surfaces as an error", func(t *testing.T) {
+		_, _, err := splitNlMsgs(encodeNlMsgError(-1))
+		if err == nil {
+			t.Errorf("splitNlMsgs() = nil error, want one for errno -1")
+		}
+	})
+
+	t.Run("malformed length", func(t *testing.T) {
+		buf := make([]byte, nlmsgHeaderLen)
+		binary.LittleEndian.PutUint32(buf[0:4], 3) // shorter than nlmsghdr itself
+		_, _, err := splitNlMsgs(buf)
+		if err == nil {
+			t.Errorf("splitNlMsgs() = nil error, want one for a too-short length")
+		}
+	})
+}
+
+// encodeAttr builds a single nlattr TLV (header + value + padding), the
+// inverse of what parseAttrs walks.
+func encodeAttr(attrType uint16, value []byte) []byte {
+	header := make([]byte, nlaHeaderLen)
+	binary.LittleEndian.PutUint16(header[0:2], uint16(nlaHeaderLen+len(value)))
+	binary.LittleEndian.PutUint16(header[2:4], attrType)
+	buf := append(header, value...)
+	if pad := nlaAlign(len(value)) - len(value); pad > 0 {
+		buf = append(buf, make([]byte, pad)...)
+	}
+	return buf
+}
+
+// encodeNlMsg builds a single nlmsghdr-framed message carrying payload
+// as its body, padded to nlaAlignTo like a real message on the wire
+// (splitNlMsgs advances by the aligned length, not the raw one).
+func encodeNlMsg(msgType uint16, payload []byte) []byte {
+	msgLen := nlmsgHeaderLen + len(payload)
+	msg := make([]byte, nlmsgHeaderLen)
+	binary.LittleEndian.PutUint32(msg[0:4], uint32(msgLen))
+	binary.LittleEndian.PutUint16(msg[4:6], msgType)
+	msg = append(msg, payload...)
+	if pad := nlaAlign(msgLen) - msgLen; pad > 0 {
+		msg = append(msg, make([]byte, pad)...)
+	}
+	return msg
+}
+
+// encodeNlMsgError builds an NLMSG_ERROR message carrying errno.
+func encodeNlMsgError(errno int32) []byte {
+	payload := make([]byte, 4)
+	binary.LittleEndian.PutUint32(payload, uint32(errno))
+	return encodeNlMsg(unix.NLMSG_ERROR, payload)
+}
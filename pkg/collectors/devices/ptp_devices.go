@@ -3,11 +3,13 @@
 package devices
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -18,10 +20,11 @@ import (
 )
 
 type PTPDeviceInfo struct {
-	Timestamp string `json:"date" fetcherKey:"date"`
-	VendorID  string `json:"vendorId" fetcherKey:"vendorID"`
-	DeviceID  string `json:"deviceInfo" fetcherKey:"devID"`
-	GNSSDev   string `json:"GNSSDev" fetcherKey:"gnss"`
+	Timestamp string     `json:"date" fetcherKey:"date"`
+	VendorID  string     `json:"vendorId" fetcherKey:"vendorID"`
+	DeviceID  string     `json:"deviceInfo" fetcherKey:"devID"`
+	GNSSDev   string     `json:"GNSSDev" fetcherKey:"gnss"`
+	GNSS      GNSSStatus `json:"gnssStatus"`
 }
 
 // AnalyserJSON returns the json expected by the analysers
@@ -41,26 +44,56 @@ func (ptpDevInfo *PTPDeviceInfo) AnalyserJSON() ([]byte, error) {
 	return line, nil
 }
 
+// DevDPLLInfo is the state of every DPLL (and its pins) on a device, as
+// reported either by the DPLL netlink subsystem or, when that's
+// unavailable, reconstructed from the legacy sysfs EEC/PPS pair. Unlike
+// the sysfs fetcher it is not bound to a fixed two-DPLL layout: N
+// DPLLs and their pins are carried in DPLLs/Pins respectively.
 type DevDPLLInfo struct {
-	Timestamp string `json:"date" fetcherKey:"date"`
-	EECState  string `json:"EECState" fetcherKey:"dpll_0_state"`
-	PPSState  string `json:"PPSState" fetcherKey:"dpll_1_state"`
-	PPSOffset string `json:"PPSOffset" fetcherKey:"dpll_1_offset"`
+	Timestamp string        `json:"date"`
+	DPLLs     []DPLLInfo    `json:"dplls"`
+	Pins      []DPLLPinInfo `json:"pins"`
+}
+
+// lockStatusByType returns the LockStatus of the first DPLL of the
+// given type (e.g. "eec", "pps"), and whether one was found.
+func (dpllInfo *DevDPLLInfo) lockStatusByType(dpllType string) (string, bool) {
+	for _, dpll := range dpllInfo.DPLLs {
+		if dpll.Type == dpllType {
+			return dpll.LockStatus, true
+		}
+	}
+	return "", false
+}
+
+// pinOffsetByParentType returns the PhaseOffset of the first pin parented
+// by a DPLL of the given type, and whether one was found.
+func (dpllInfo *DevDPLLInfo) pinOffsetByParentType(dpllType string) (float64, bool) {
+	for _, dpll := range dpllInfo.DPLLs {
+		if dpll.Type != dpllType {
+			continue
+		}
+		for _, pin := range dpllInfo.Pins {
+			if pin.ParentID == dpll.ID {
+				return pin.PhaseOffset, true
+			}
+		}
+	}
+	return 0, false
 }
 
 // AnalyserJSON returns the json expected by the analysers
 func (dpllInfo *DevDPLLInfo) AnalyserJSON() ([]byte, error) {
-	offset, err := strconv.ParseFloat(dpllInfo.PPSOffset, 32)
-	if err != nil {
-		return []byte{}, fmt.Errorf("failed converting PPSOffset %w", err)
-	}
+	eecState, _ := dpllInfo.lockStatusByType("eec")
+	ppsState, _ := dpllInfo.lockStatusByType("pps")
+	ppsOffset, _ := dpllInfo.pinOffsetByParentType("pps")
 	line, err := json.Marshal(&callbacks.AnalyserFormatType{
 		ID: "dpll/time-error",
 		Data: []string{
 			dpllInfo.Timestamp,
-			dpllInfo.EECState,
-			dpllInfo.PPSState,
-			fmt.Sprintf("%f", offset/unitConversionFactor),
+			eecState,
+			ppsState,
+			fmt.Sprintf("%f", ppsOffset),
 		},
 	})
 	if err != nil {
@@ -69,26 +102,65 @@ func (dpllInfo *DevDPLLInfo) AnalyserJSON() ([]byte, error) {
 	return line, nil
 }
 
-const (
-	unitConversionFactor = 100
-)
+// unitConversionFactor converts the raw DPLL phase-offset reading
+// emitted by the sysfs dpll_1_offset file into seconds. It is specific
+// to that sysfs encoding: the netlink DPLL_A_PIN_PHASE_OFFSET
+// attribute this package also reads (dpll_netlink.go) uses a different
+// scale and has its own dpllPinPhaseOffsetDivisor. Every offset
+// DevDPLLInfo/DPLLPinInfo carries -- and everything derived from it,
+// such as AnalyserJSON's dpll/time-error data and the
+// vse_dpll_pps_offset_seconds gauge -- is in seconds as a result.
+const unitConversionFactor = 100
 
 var (
-	devFetcher  map[string]*fetcher
-	dpllFetcher map[string]*fetcher
+	fetcherMu   sync.RWMutex
+	devFetcher  = make(map[string]*fetcher)
+	dpllFetcher = make(map[string]*fetcher)
+
+	dateCmdOnce sync.Once
 	dateCmd     *clients.Cmd
+	dateCmdErr  error
 )
 
-func init() {
-	devFetcher = make(map[string]*fetcher)
-	dpllFetcher = make(map[string]*fetcher)
-	dateCmdInst, err := clients.NewCmd("date", "date +%s.%N")
-	if err != nil {
-		panic(err)
-	}
-	dateCmd = dateCmdInst
-	dateCmd.SetCleanupFunc(FormatTimestampAsRFC3339Nano)
+// getDateCmd lazily builds the shared "date" command on first use and
+// caches the result (success or failure), rather than panicking at
+// package init time if the command can't be constructed.
+func getDateCmd() (*clients.Cmd, error) {
+	dateCmdOnce.Do(func() {
+		dateCmd, dateCmdErr = clients.NewCmd("date", "date +%s.%N")
+		if dateCmdErr == nil {
+			dateCmd.SetCleanupFunc(FormatTimestampAsRFC3339Nano)
+		}
+	})
+	return dateCmd, dateCmdErr
+}
+
+func getDevFetcher(interfaceName string) (*fetcher, bool) {
+	fetcherMu.RLock()
+	defer fetcherMu.RUnlock()
+	fetcherInst, ok := devFetcher[interfaceName]
+	return fetcherInst, ok
 }
+
+func setDevFetcher(interfaceName string, fetcherInst *fetcher) {
+	fetcherMu.Lock()
+	defer fetcherMu.Unlock()
+	devFetcher[interfaceName] = fetcherInst
+}
+
+func getDPLLFetcher(interfaceName string) (*fetcher, bool) {
+	fetcherMu.RLock()
+	defer fetcherMu.RUnlock()
+	fetcherInst, ok := dpllFetcher[interfaceName]
+	return fetcherInst, ok
+}
+
+func setDPLLFetcher(interfaceName string, fetcherInst *fetcher) {
+	fetcherMu.Lock()
+	defer fetcherMu.Unlock()
+	dpllFetcher[interfaceName] = fetcherInst
+}
+
 func FormatTimestampAsRFC3339Nano(s string) (string, error) {
 	timestamp, err := utils.ParseTimestamp(strings.TrimSpace(s))
 	if err != nil {
@@ -101,11 +173,14 @@ func FormatTimestampAsRFC3339Nano(s string) (string, error) {
 // collecting the PTPDeviceInfo
 func BuildPTPDeviceInfo(interfaceName string) error {
 	fetcherInst := NewFetcher()
-	devFetcher[interfaceName] = fetcherInst
 
-	fetcherInst.AddCommand(dateCmd)
+	dateCmdInst, err := getDateCmd()
+	if err != nil {
+		return fmt.Errorf("failed to fetch devInfo %w", err)
+	}
+	fetcherInst.AddCommand(dateCmdInst)
 
-	err := fetcherInst.AddNewCommand(
+	err = fetcherInst.AddNewCommand(
 		"gnss",
 		fmt.Sprintf("ls /sys/class/net/%s/device/gnss/", interfaceName),
 		true,
@@ -132,43 +207,93 @@ func BuildPTPDeviceInfo(interfaceName string) error {
 		log.Errorf("failed to add command %s %s", "vendorID", err.Error())
 		return fmt.Errorf("failed to fetch devInfo %w", err)
 	}
+	setDevFetcher(interfaceName, fetcherInst)
 	return nil
 }
 
-// GetPTPDeviceInfo returns the PTPDeviceInfo for an interface
-func GetPTPDeviceInfo(interfaceName string, ctx clients.ContainerContext) (PTPDeviceInfo, error) {
+// GetPTPDeviceInfo returns the PTPDeviceInfo for an interface. goCtx
+// bounds how long the whole call (including the container-exec backed
+// fetch and the GNSS status read) may run; cancelling or timing it out
+// propagates into the underlying clients.Cmd execution.
+func GetPTPDeviceInfo(goCtx context.Context, interfaceName string, ctx clients.ContainerContext) (PTPDeviceInfo, error) {
 	devInfo := PTPDeviceInfo{}
 	// Find the dev for the GNSS for this interface
-	fetcherInst, fetchedInstanceOk := devFetcher[interfaceName]
+	fetcherInst, fetchedInstanceOk := getDevFetcher(interfaceName)
 	if !fetchedInstanceOk {
 		err := BuildPTPDeviceInfo(interfaceName)
 		if err != nil {
 			return devInfo, err
 		}
-		fetcherInst, fetchedInstanceOk = devFetcher[interfaceName]
+		fetcherInst, fetchedInstanceOk = getDevFetcher(interfaceName)
 		if !fetchedInstanceOk {
 			return devInfo, errors.New("failed to create fetcher for PTPDeviceInfo")
 		}
 	}
 
-	err := fetcherInst.Fetch(ctx, &devInfo)
+	err := fetcherInst.Fetch(goCtx, ctx, &devInfo)
 	if err != nil {
 		log.Errorf("failed to fetch devInfo %s", err.Error())
 		return devInfo, fmt.Errorf("failed to fetch devInfo %w", err)
 	}
 	devInfo.GNSSDev = "/dev/" + devInfo.GNSSDev
+
+	gnssStatus, err := GetGNSSStatus(goCtx, ctx, devInfo.GNSSDev, devInfo.Timestamp)
+	if err != nil {
+		log.Errorf("failed to fetch gnss status %s", err.Error())
+	} else {
+		devInfo.GNSS = gnssStatus
+	}
 	return devInfo, nil
 }
 
-// BuildDPLLInfoFetcher popluates the fetcher required for
-// collecting the DPLLInfo
+// sysfsDPLLFields is the flat EEC/PPS pair the legacy sysfs fetcher
+// reads; it only ever describes exactly two DPLLs, which is why
+// DevDPLLInfo no longer uses it directly.
+type sysfsDPLLFields struct {
+	Timestamp string `fetcherKey:"date"`
+	EECState  string `fetcherKey:"dpll_0_state"`
+	PPSState  string `fetcherKey:"dpll_1_state"`
+	PPSOffset string `fetcherKey:"dpll_1_offset"`
+}
+
+const (
+	sysfsDPLLEECID uint32 = 0
+	sysfsDPLLPPSID uint32 = 1
+)
+
+// toDevDPLLInfo reshapes the legacy sysfs EEC/PPS pair into the general
+// N-DPLL/per-pin DevDPLLInfo shape so callers see one type regardless
+// of which fetch path produced it.
+func (fields sysfsDPLLFields) toDevDPLLInfo() DevDPLLInfo {
+	offset, err := strconv.ParseFloat(fields.PPSOffset, 64)
+	if err != nil {
+		log.Errorf("failed converting PPSOffset %s", err.Error())
+	}
+	return DevDPLLInfo{
+		Timestamp: fields.Timestamp,
+		DPLLs: []DPLLInfo{
+			{ID: sysfsDPLLEECID, Type: "eec", LockStatus: fields.EECState},
+			{ID: sysfsDPLLPPSID, Type: "pps", LockStatus: fields.PPSState},
+		},
+		Pins: []DPLLPinInfo{
+			{ID: sysfsDPLLPPSID, ParentID: sysfsDPLLPPSID, PhaseOffset: offset / unitConversionFactor},
+		},
+	}
+}
+
+// BuildDPLLInfoFetcher popluates the fetcher required for collecting
+// the DPLLInfo via the legacy sysfs files. It's kept as the fallback
+// GetDevDPLLInfo uses when the kernel DPLL netlink family is absent.
 func BuildDPLLInfoFetcher(interfaceName string) error {
 	fetcherInst := NewFetcher()
-	dpllFetcher[interfaceName] = fetcherInst
 
-	fetcherInst.AddCommand(dateCmd)
+	dateCmdInst, err := getDateCmd()
+	if err != nil {
+		return err
+	}
+	fetcherInst.AddCommand(dateCmdInst)
 
-	err := fetcherInst.AddNewCommand(
+	err = fetcherInst.AddNewCommand(
 		"dpll_0_state",
 		fmt.Sprintf("cat /sys/class/net/%s/device/dpll_0_state", interfaceName),
 		true,
@@ -197,27 +322,70 @@ func BuildDPLLInfoFetcher(interfaceName string) error {
 		log.Errorf("failed to add command %s %s", "dpll_1_offset", err.Error())
 		return err
 	}
+	setDPLLFetcher(interfaceName, fetcherInst)
 	return nil
 }
 
-// GetDevDPLLInfo returns the device DPLL info for an interface.
-func GetDevDPLLInfo(ctx clients.ContainerContext, interfaceName string) (DevDPLLInfo, error) {
-	dpllInfo := DevDPLLInfo{}
-	fetcherInst, fetchedInstanceOk := dpllFetcher[interfaceName]
+// getDevDPLLInfoSysfs is the fallback path for GetDevDPLLInfo, used
+// when the DPLL netlink family can't be resolved on this host.
+func getDevDPLLInfoSysfs(goCtx context.Context, ctx clients.ContainerContext, interfaceName string) (DevDPLLInfo, error) {
+	fields := sysfsDPLLFields{}
+	fetcherInst, fetchedInstanceOk := getDPLLFetcher(interfaceName)
 	if !fetchedInstanceOk {
 		err := BuildDPLLInfoFetcher(interfaceName)
 		if err != nil {
-			return dpllInfo, err
+			return DevDPLLInfo{}, err
 		}
-		fetcherInst, fetchedInstanceOk = dpllFetcher[interfaceName]
+		fetcherInst, fetchedInstanceOk = getDPLLFetcher(interfaceName)
 		if !fetchedInstanceOk {
-			return dpllInfo, errors.New("failed to create fetcher for DPLLInfo")
+			return DevDPLLInfo{}, errors.New("failed to create fetcher for DPLLInfo")
 		}
 	}
-	err := fetcherInst.Fetch(ctx, &dpllInfo)
+	err := fetcherInst.Fetch(goCtx, ctx, &fields)
 	if err != nil {
 		log.Errorf("failed to fetch dpllInfo %s", err.Error())
-		return dpllInfo, err
+		return DevDPLLInfo{}, err
+	}
+	return fields.toDevDPLLInfo(), nil
+}
+
+// timestampFields is used to fetch just the current timestamp, for
+// code paths (like the DPLL netlink fetch) that don't otherwise go
+// through a fetcher.
+type timestampFields struct {
+	Timestamp string `fetcherKey:"date"`
+}
+
+func currentTimestamp(goCtx context.Context, ctx clients.ContainerContext) string {
+	dateCmdInst, err := getDateCmd()
+	if err != nil {
+		log.Errorf("failed to build date command: %s", err.Error())
+		return ""
+	}
+	fetcherInst := NewFetcher()
+	fetcherInst.AddCommand(dateCmdInst)
+	fields := timestampFields{}
+	if err := fetcherInst.Fetch(goCtx, ctx, &fields); err != nil {
+		log.Errorf("failed to fetch timestamp: %s", err.Error())
+		return ""
+	}
+	return fields.Timestamp
+}
+
+// GetDevDPLLInfo returns the device DPLL info for an interface, in
+// preference via the kernel DPLL netlink subsystem; when that family
+// isn't available on this host (older kernel, module not loaded) it
+// falls back to the sysfs files the ice driver still exposes. goCtx
+// bounds both paths: the netlink reads/writes via SO_RCVTIMEO/SO_SNDTIMEO
+// (see armSocketDeadline in netlink.go) and the underlying clients.Cmd
+// execution on the sysfs path.
+func GetDevDPLLInfo(goCtx context.Context, ctx clients.ContainerContext, interfaceName string) (DevDPLLInfo, error) {
+	if dpllNetlinkAvailable(goCtx) {
+		dpllInfo, err := fetchDPLLInfoNetlink(goCtx, interfaceName, currentTimestamp(goCtx, ctx))
+		if err == nil {
+			return dpllInfo, nil
+		}
+		log.Errorf("dpll netlink fetch failed for %s, falling back to sysfs: %s", interfaceName, err.Error())
 	}
-	return dpllInfo, nil
+	return getDevDPLLInfoSysfs(goCtx, ctx, interfaceName)
 }